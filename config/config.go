@@ -1 +1,20 @@
 package config
+
+import (
+	"context"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Env returns the value set for key under runtime.env in the Nakama config,
+// or fallback when it isn't set
+func Env(ctx context.Context, key, fallback string) string {
+	env, ok := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	if !ok {
+		return fallback
+	}
+	if v, ok := env[key]; ok && v != "" {
+		return v
+	}
+	return fallback
+}
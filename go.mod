@@ -2,6 +2,7 @@ module github.com/titan/titan-runtime
 
 go 1.24.5
 
-require github.com/heroiclabs/nakama-common v1.38.0
-
-require google.golang.org/protobuf v1.36.6 // indirect
+require (
+	github.com/heroiclabs/nakama-common v1.38.0
+	google.golang.org/protobuf v1.36.6
+)
@@ -4,21 +4,48 @@ import (
 	"context"
 	"database/sql"
 	"time"
+	// schedules and user timezones are resolved without relying on the host's zoneinfo
+	_ "time/tzdata"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/titan/titan-runtime/modules/account"
 	eventProcessor "github.com/titan/titan-runtime/modules/common/eventProcessor"
+	"github.com/titan/titan-runtime/modules/common/i18n"
+	"github.com/titan/titan-runtime/modules/common/moderation"
+	"github.com/titan/titan-runtime/modules/common/notifier"
+	"github.com/titan/titan-runtime/modules/common/outbox"
+	"github.com/titan/titan-runtime/modules/common/registry"
+	"github.com/titan/titan-runtime/modules/common/scheduler"
 	"github.com/titan/titan-runtime/modules/leaderboard"
+	"github.com/titan/titan-runtime/modules/progression"
+	"github.com/titan/titan-runtime/modules/streak"
 	"github.com/titan/titan-runtime/modules/test_events"
 )
 
+// modules are initialized in this order, a module may rely on anything
+// registered by the modules above it
+var modules = []registry.Module{
+	{Name: "i18n", Init: i18n.InitModule},
+	{Name: "event_processor", Init: eventProcessor.InitModule},
+	{Name: "outbox", Init: outbox.InitModule},
+	{Name: "scheduler", Init: scheduler.InitModule},
+	{Name: "notifier", Init: notifier.InitModule},
+	{Name: "moderation", Init: moderation.InitModule},
+	{Name: "account", Init: account.InitModule},
+	{Name: "leaderboard", Init: leaderboard.InitModule},
+	{Name: "leaderboard_callbacks", Init: leaderboard.InitModuleCallbacks},
+	{Name: "progression", Init: progression.InitModule},
+	{Name: "streak", Init: streak.InitModule},
+	{Name: "test_events", Init: test_events.InitModule, Optional: true},
+}
+
 func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
 	initStart := time.Now()
 	logger.Info("Initializing Titan Runtime")
-	account.InitModule(ctx, logger, db, nk, initializer)
-	eventProcessor.InitModule(ctx, logger, db, nk, initializer)
-	leaderboard.InitModuleCallbacks(ctx, logger, db, nk, initializer)
-	test_events.InitModule(ctx, logger, db, nk, initializer)
+	if _, err := registry.Run(ctx, logger, db, nk, initializer, modules); err != nil {
+		logger.Error("Titan Runtime failed to initialize in %s: %v", time.Since(initStart), err)
+		return err
+	}
 	logger.Info("Titan Runtime initialized in %s", time.Since(initStart))
 	return nil
 }
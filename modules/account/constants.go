@@ -1,8 +1,28 @@
 package account
 
-type NotificationMessage int
+import (
+	"time"
 
+	"github.com/titan/titan-runtime/modules/common/notifier"
+)
+
+// notification codes sent by the account domain
 const (
-	UserLoggedIn NotificationMessage = iota + 1
+	UserLoggedIn notifier.NotificationMessage = iota + 1
 	UserProfileUpdated
 )
+
+var notificationTemplates = map[notifier.NotificationMessage]notifier.Template{
+	UserLoggedIn: {
+		Subject:  "Welcome back",
+		Body:     "You logged in successfully",
+		Audience: notifier.AudienceSelf,
+	},
+	UserProfileUpdated: {
+		Subject:  "Profile updated",
+		Body:     "Your profile was updated",
+		Audience: notifier.AudienceSelf,
+	},
+}
+
+const accountRPCTimeout = 5 * time.Second
@@ -3,44 +3,74 @@ package account
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strconv"
 
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
-	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+	"github.com/titan/titan-runtime/modules/common/i18n"
+	"github.com/titan/titan-runtime/modules/common/moderation"
 	"github.com/titan/titan-runtime/modules/common/notifier"
+	"github.com/titan/titan-runtime/modules/common/outbox"
+	"github.com/titan/titan-runtime/modules/utils"
 )
 
 func BeforeAuthenticateDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *api.AuthenticateDeviceRequest) (*api.AuthenticateDeviceRequest, error) {
 	logger.Info("BeforeAuthenticateDevice:----------------- %+v", in.Username)
+	if err := moderation.CheckDeviceAuth(ctx, logger, db, in.GetAccount().GetId()); err != nil {
+		return nil, err
+	}
+	// the username is only used when the account gets created, which is
+	// the default
+	create := in.Create == nil || in.Create.Value
+	if create && in.Username != "" {
+		if err := moderation.CheckName(in.Username); err != nil {
+			logger.Info("Rejected username %q: %v", in.Username, err)
+			return nil, moderation.FieldError("username", err)
+		}
+	}
 	return in, nil
 }
 
 func AfterAuthenticateDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateDeviceRequest) error {
-	content := map[string]interface{}{
-		"display_name": in.Username,
-		"message":      "logged in successfully",
-	}
-	if err := notifier.SendNotifications(ctx, nk, logger, in.Account.Id, in.Account.Id, content, false, int(UserProfileUpdated)); err != nil {
+	// in.Account.Id is the device id, the user is only known from the session
+	userID := utils.UserID(ctx)
+	vars := notifier.Vars{"created": out.Created}
+	if err := notifier.Notify(ctx, nk, logger, UserLoggedIn, notifier.Recipients{Self: userID}, vars); err != nil {
 		logger.Error("Failed to send notifications: %v", err)
 	}
-	if err := eventEmitter.EmitEvent(ctx, nk, "account_updated", map[string]string{"profile": in.Username}); err != nil {
-		logger.Error("Failed to emit account_logged_in event: %v", err)
+	logger.Info("AfterAuthenticateDevice: %s logged in", userID)
+	// the session is already issued, the error only reaches nakama's log
+	if err := outbox.Emit(ctx, db, "account_logged_in", map[string]string{
+		"user_id": userID,
+		"created": strconv.FormatBool(out.Created),
+	}); err != nil {
+		return fmt.Errorf("failed to emit account_logged_in for %s: %w", userID, err)
 	}
-	logger.Info("AfterAuthenticateDevice:----------------- %+v", out.Token)
 	return nil
 }
 
 func AfterUpdateAccount(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *api.UpdateAccountRequest) error {
-	logger.Info("AfterUpdateAccount:----------------- %+v", in.Username)
-	if err := eventEmitter.EmitEvent(ctx, nk, "account_updated", map[string]string{"profile": in.DisplayName.Value}); err != nil {
-		logger.Error("Failed to emit account_updated event: %v", err)
+	// in.Username is the new username when it changes, never the user id
+	userID := utils.UserID(ctx)
+	if in.GetLangTag() != nil {
+		i18n.Forget(userID)
 	}
-	content := map[string]interface{}{
-		"display_name": in.Username,
-		"message":      "profile updated successfully",
+	if displayName := in.GetDisplayName().GetValue(); displayName != "" {
+		if err := moderation.ConfirmDisplayName(ctx, db, userID, displayName); err != nil {
+			logger.Error("Failed to confirm display name %q: %v", displayName, err)
+		}
 	}
-	if err := notifier.SendNotifications(ctx, nk, logger, in.Username.Value, in.Username.Value, content, false, int(UserProfileUpdated)); err != nil {
+	logger.Info("AfterUpdateAccount:----------------- %+v", userID)
+	vars := notifier.Vars{"display_name": in.GetDisplayName().GetValue()}
+	if err := notifier.Notify(ctx, nk, logger, UserProfileUpdated, notifier.Recipients{Self: userID}, vars); err != nil {
 		logger.Error("Failed to send notifications: %v", err)
 	}
+	if err := outbox.Emit(ctx, db, "account_updated", map[string]string{
+		"user_id": userID,
+		"profile": in.GetDisplayName().GetValue(),
+	}); err != nil {
+		return fmt.Errorf("failed to emit account_updated for %s: %w", userID, err)
+	}
 	return nil
 }
@@ -5,12 +5,22 @@ import (
 	"database/sql"
 
 	"github.com/heroiclabs/nakama-common/runtime"
+	eventProcessor "github.com/titan/titan-runtime/modules/common/eventProcessor"
+	"github.com/titan/titan-runtime/modules/common/notifier"
+	"github.com/titan/titan-runtime/modules/common/rpc"
 )
 
 // ONE InitModule per domain - handles ALL user stuff
 func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
 	logger.Info("Initializing User domain...")
-	if err := initializer.RegisterRpc("update_account", UpdateAccountHandler); err != nil {
+	for code, t := range notificationTemplates {
+		if err := notifier.Register(code, t); err != nil {
+			return err
+		}
+	}
+
+	router := rpc.NewRouter(initializer)
+	if err := rpc.Register(router, "update_account", UpdateAccountHandler, rpc.RequireAuth, rpc.Timeout(accountRPCTimeout)); err != nil {
 		return err
 	}
 	if err := initializer.RegisterBeforeAuthenticateDevice(BeforeAuthenticateDevice); err != nil {
@@ -24,6 +34,10 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 		return err
 	}
 
+	if err := eventProcessor.Subscribe("account_updated", "account", HandleAccountUpdatedEvent); err != nil {
+		return err
+	}
+
 	logger.Info("User domain initialized")
 	return nil
 }
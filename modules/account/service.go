@@ -2,33 +2,152 @@ package account
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
-	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+	"github.com/titan/titan-runtime/modules/common/i18n"
 	"github.com/titan/titan-runtime/modules/common/models"
+	"github.com/titan/titan-runtime/modules/common/moderation"
 	"github.com/titan/titan-runtime/modules/common/notifier"
+	"github.com/titan/titan-runtime/modules/common/outbox"
+	"github.com/titan/titan-runtime/modules/common/services"
+	"github.com/titan/titan-runtime/modules/common/validation"
+	shared "github.com/titan/titan-runtime/shared"
 )
 
-func HandleAccountUpdatedEvent(ctx context.Context, logger runtime.Logger, evt *api.Event) {
-	logger.Debug("account_updated event received")
+var errNothingToUpdate = runtime.NewError("no profile field to update", shared.INVALID_ARGUMENT)
 
+func HandleAccountUpdatedEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) error {
+	logger.Debug("account_updated event received")
+	return nil
 }
 
-func UpdateAccount(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, userID string, req *models.UpdateProfileRequest) (*models.UpdateProfileResponse, error) {
-	logger.Info("Updating account: %+v", req)
+// UpdateAccount applies the fields set in req and returns the updated
+// account
+func UpdateAccount(ctx context.Context, db *sql.DB, nk runtime.NakamaModule, logger runtime.Logger, userID string, req *models.UpdateProfileRequest) (*models.Account, error) {
+	if req.Empty() {
+		return nil, errNothingToUpdate
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" {
+			return nil, validation.Errors{{Field: "timezone", Rule: "timezone", Message: "must be an IANA time zone"}}
+		}
+	}
+
+	if req.DisplayName != nil {
+		if err := moderation.ValidateDisplayName(ctx, db, userID, *req.DisplayName); err != nil {
+			logger.Info("Rejected display name %q: %v", *req.DisplayName, err)
+			return nil, moderation.FieldError("display_name", err)
+		}
+	}
+
+	var metadata map[string]interface{}
+	if len(req.Metadata) > 0 {
+		var err error
+		if metadata, err = mergeMetadata(ctx, nk, userID, req.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	// empty strings leave a field unchanged
+	if err := services.AccountUpdateId(ctx, nk, logger, userID, "",
+		stringOrEmpty(req.AvatarURL), stringOrEmpty(req.LangTag), metadata,
+		stringOrEmpty(req.DisplayName), stringOrEmpty(req.Timezone), stringOrEmpty(req.Location)); err != nil {
+		if req.DisplayName != nil {
+			if releaseErr := moderation.ReleaseDisplayName(ctx, db, userID, *req.DisplayName); releaseErr != nil {
+				logger.Error("Failed to release display name %q: %v", *req.DisplayName, releaseErr)
+			}
+		}
+		return nil, fmt.Errorf("failed to update account %s: %w", userID, err)
+	}
+	if req.DisplayName != nil {
+		if err := moderation.ConfirmDisplayName(ctx, db, userID, *req.DisplayName); err != nil {
+			logger.Error("Failed to confirm display name %q: %v", *req.DisplayName, err)
+		}
+	}
+
+	if req.LangTag != nil {
+		i18n.Forget(userID)
+	}
+
+	account, err := services.GetAccountId(ctx, nk, logger, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read updated account %s: %w", userID, err)
+	}
+	fields := strings.Join(updatedFields(req), ",")
+	logger.Info("Updated account fields %s", fields)
 
-	if err := eventEmitter.EmitEvent(ctx, nk, "account_updated", map[string]string{"profile": req.DisplayName}); err != nil {
+	// nakama committed the update on its own, so the event can't share its
+	// transaction. A failed emit fails the call instead: the update is
+	// idempotent, and the client's retry emits the event.
+	if err := outbox.Emit(ctx, db, "account_updated", map[string]string{
+		"user_id": userID,
+		"profile": account.DisplayName,
+		"fields":  fields,
+	}); err != nil {
 		logger.Error("Failed to emit account_updated event: %v", err)
+		return nil, fmt.Errorf("failed to emit account_updated for %s: %w", userID, err)
 	}
-	content := map[string]interface{}{
-		"display_name": req.DisplayName,
+	vars := notifier.Vars{
+		"display_name": account.DisplayName,
+		"fields":       fields,
 	}
-	if err := notifier.SendNotifications(ctx, nk, logger, userID, userID, content, false, int(UserProfileUpdated)); err != nil {
+	if err := notifier.Notify(ctx, nk, logger, UserProfileUpdated, notifier.Recipients{Self: userID}, vars); err != nil {
 		logger.Error("Failed to send notifications: %v", err)
 	}
-	return &models.UpdateProfileResponse{
-		Success: true,
-		Message: "Profile updated successfully",
-	}, nil
+	return account, nil
+}
+
+// mergeMetadata returns the current metadata of the account with updates
+// applied, keys set to "" are removed
+func mergeMetadata(ctx context.Context, nk runtime.NakamaModule, userID string, updates map[string]string) (map[string]interface{}, error) {
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account %s: %w", userID, err)
+	}
+	metadata := make(map[string]interface{})
+	if raw := account.GetUser().GetMetadata(); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &metadata); err != nil {
+			return nil, fmt.Errorf("failed to parse metadata of account %s: %w", userID, err)
+		}
+	}
+	for k, v := range updates {
+		if v == "" {
+			delete(metadata, k)
+			continue
+		}
+		metadata[k] = v
+	}
+	return metadata, nil
+}
+
+func updatedFields(req *models.UpdateProfileRequest) []string {
+	var fields []string
+	for name, set := range map[string]bool{
+		"display_name": req.DisplayName != nil,
+		"avatar_url":   req.AvatarURL != nil,
+		"lang_tag":     req.LangTag != nil,
+		"timezone":     req.Timezone != nil,
+		"location":     req.Location != nil,
+		"metadata":     len(req.Metadata) > 0,
+	} {
+		if set {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
 }
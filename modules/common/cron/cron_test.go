@@ -0,0 +1,94 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "every minute", expr: "* * * * *"},
+		{name: "macro", expr: "@daily"},
+		{name: "macro upper case", expr: "@HOURLY"},
+		{name: "lists ranges and steps", expr: "0,30 9-17 */2 1-6/2 mon-fri"},
+		{name: "names", expr: "0 0 * jan,jul sun"},
+		{name: "sunday as 7", expr: "0 0 * * 7"},
+		{name: "question marks", expr: "0 0 ? * ?"},
+		{name: "surrounding spaces", expr: "  0 0 * * *  "},
+		{name: "empty", expr: "", wantErr: true},
+		{name: "too few fields", expr: "0 0 * *", wantErr: true},
+		{name: "too many fields", expr: "0 0 0 * * *", wantErr: true},
+		{name: "unknown macro", expr: "@weekdays", wantErr: true},
+		{name: "minute out of range", expr: "60 * * * *", wantErr: true},
+		{name: "hour out of range", expr: "0 24 * * *", wantErr: true},
+		{name: "day of month zero", expr: "0 0 0 * *", wantErr: true},
+		{name: "month out of range", expr: "0 0 1 13 *", wantErr: true},
+		{name: "day of week out of range", expr: "0 0 * * 8", wantErr: true},
+		{name: "reversed range", expr: "0 17-9 * * *", wantErr: true},
+		{name: "zero step", expr: "*/0 * * * *", wantErr: true},
+		{name: "negative step", expr: "*/-5 * * * *", wantErr: true},
+		{name: "empty list item", expr: "0, * * * *", wantErr: true},
+		{name: "unknown name", expr: "0 0 * * funday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, want error %t", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.UTC()
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{name: "next minute", expr: "* * * * *", from: utc("2025-03-10T10:15:30Z"), want: utc("2025-03-10T10:16:00Z")},
+		{name: "strictly after", expr: "30 10 * * *", from: utc("2025-03-10T10:30:00Z"), want: utc("2025-03-11T10:30:00Z")},
+		{name: "later today", expr: "0 12 * * *", from: utc("2025-03-10T10:15:00Z"), want: utc("2025-03-10T12:00:00Z")},
+		{name: "step", expr: "*/15 * * * *", from: utc("2025-03-10T10:16:00Z"), want: utc("2025-03-10T10:30:00Z")},
+		{name: "start and step", expr: "5/20 * * * *", from: utc("2025-03-10T10:26:00Z"), want: utc("2025-03-10T10:45:00Z")},
+		{name: "day of week", expr: "0 9 * * mon", from: utc("2025-03-12T10:00:00Z"), want: utc("2025-03-17T09:00:00Z")},
+		{name: "sunday as 7", expr: "0 0 * * 7", from: utc("2025-03-10T00:00:00Z"), want: utc("2025-03-16T00:00:00Z")},
+		{name: "month rollover", expr: "0 0 1 * *", from: utc("2025-12-15T00:00:00Z"), want: utc("2026-01-01T00:00:00Z")},
+		{name: "leap day", expr: "0 0 29 2 *", from: utc("2025-03-01T00:00:00Z"), want: utc("2028-02-29T00:00:00Z")},
+		{name: "either day field", expr: "0 0 13 * fri", from: utc("2025-03-10T00:00:00Z"), want: utc("2025-03-13T00:00:00Z")},
+		{name: "never", expr: "0 0 30 2 *", from: utc("2025-03-10T00:00:00Z"), want: time.Time{}},
+		{name: "location", expr: "0 9 * * *", from: time.Date(2025, 1, 10, 10, 0, 0, 0, newYork), want: utc("2025-01-11T14:00:00Z")},
+		{name: "across dst start", expr: "0 9 * * *", from: time.Date(2025, 3, 8, 10, 0, 0, 0, newYork), want: utc("2025-03-09T13:00:00Z")},
+		{name: "hour skipped by dst", expr: "30 2 * * *", from: time.Date(2025, 3, 8, 10, 0, 0, 0, newYork), want: utc("2025-03-10T06:30:00Z")},
+		{name: "across dst end", expr: "0 9 * * *", from: time.Date(2025, 11, 1, 10, 0, 0, 0, newYork), want: utc("2025-11-02T14:00:00Z")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			got := s.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Fatalf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
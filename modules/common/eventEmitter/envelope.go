@@ -0,0 +1,161 @@
+package eventemitter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/titan/titan-runtime/modules/utils"
+)
+
+// SchemaVersion is the version of the envelope written by this build
+const SchemaVersion = 1
+
+// envelope fields travel in the event properties under these reserved keys
+const (
+	PropEventID       = "_event_id"
+	PropSchemaVersion = "_schema_version"
+	PropEmittedAt     = "_emitted_at"
+	PropCorrelationID = "_correlation_id"
+	PropCausationID   = "_causation_id"
+	PropUserID        = "_user_id"
+	PropIdempotency   = "_idempotency_key"
+)
+
+// IdempotencyKeyProp can be set by the emitter (or a client) to mark
+// events that must only be processed once, e.g. when a request is retried
+const IdempotencyKeyProp = "idempotency_key"
+
+// Envelope is the metadata every emitted event carries. The correlation id
+// is shared by a whole chain of events (node -> daily -> season), the
+// causation id is the id of the event whose handler emitted this one.
+type Envelope struct {
+	EventID       string    `json:"event_id"`
+	SchemaVersion int       `json:"schema_version"`
+	EmittedAt     time.Time `json:"emitted_at"`
+	CorrelationID string    `json:"correlation_id"`
+	CausationID   string    `json:"causation_id,omitempty"`
+	UserID        string    `json:"user_id,omitempty"`
+	// IdempotencyKey identifies the logical event, deliveries sharing a key
+	// are processed once
+	IdempotencyKey string `json:"idempotency_key"`
+}
+
+type envelopeCtxKey struct{}
+
+// WithEnvelope returns a context carrying the envelope of the event being
+// handled, events emitted with it become part of that event's chain
+func WithEnvelope(ctx context.Context, env Envelope) context.Context {
+	return context.WithValue(ctx, envelopeCtxKey{}, env)
+}
+
+// EnvelopeFromContext returns the envelope of the event being handled
+func EnvelopeFromContext(ctx context.Context) (Envelope, bool) {
+	env, ok := ctx.Value(envelopeCtxKey{}).(Envelope)
+	return env, ok
+}
+
+// NewEnvelope creates the envelope for a new event, continuing the chain
+// of the event being handled in ctx if there is one
+func NewEnvelope(ctx context.Context) Envelope {
+	env := Envelope{
+		EventID:       utils.NewID(),
+		SchemaVersion: SchemaVersion,
+		EmittedAt:     time.Now().UTC(),
+	}
+	env.CorrelationID = env.EventID
+
+	if parent, ok := EnvelopeFromContext(ctx); ok {
+		env.CorrelationID = parent.CorrelationID
+		env.CausationID = parent.EventID
+		env.UserID = parent.UserID
+	}
+	if userID := utils.UserID(ctx); userID != "" {
+		env.UserID = userID
+	}
+	return env
+}
+
+// Apply writes the envelope into the event properties
+func (e Envelope) Apply(props map[string]string) {
+	props[PropEventID] = e.EventID
+	props[PropSchemaVersion] = strconv.Itoa(e.SchemaVersion)
+	props[PropEmittedAt] = strconv.FormatInt(e.EmittedAt.UnixMilli(), 10)
+	props[PropCorrelationID] = e.CorrelationID
+	props[PropCausationID] = e.CausationID
+	props[PropUserID] = e.UserID
+	props[PropIdempotency] = e.IdempotencyKey
+}
+
+// EnvelopeFromEvent reads the envelope from the event properties, it
+// reports false for events that weren't emitted through EmitEvent
+func EnvelopeFromEvent(evt *api.Event) (Envelope, bool) {
+	props := evt.GetProperties()
+	id := props[PropEventID]
+	if id == "" {
+		return Envelope{}, false
+	}
+
+	env := Envelope{
+		EventID:        id,
+		CorrelationID:  props[PropCorrelationID],
+		CausationID:    props[PropCausationID],
+		UserID:         props[PropUserID],
+		IdempotencyKey: props[PropIdempotency],
+	}
+	env.SchemaVersion, _ = strconv.Atoi(props[PropSchemaVersion])
+	if ms, err := strconv.ParseInt(props[PropEmittedAt], 10, 64); err == nil {
+		env.EmittedAt = time.UnixMilli(ms).UTC()
+	}
+	if env.CorrelationID == "" {
+		env.CorrelationID = id
+	}
+	if env.IdempotencyKey == "" {
+		env.IdempotencyKey = id
+	}
+	return env, true
+}
+
+// IdempotencyKey derives the idempotency key of a new event:
+//   - for events emitted while handling another event, the parent key plus a
+//     digest of the event, so a re-run handler emits the same keys again
+//   - the key the emitter set under IdempotencyKeyProp, scoped by event name
+//   - otherwise the event id, which only guards against re-delivery
+//
+// The parent chain wins over IdempotencyKeyProp since handlers often
+// re-emit the properties they received, key included.
+func IdempotencyKey(ctx context.Context, eventName string, props map[string]string, eventID string) string {
+	if parent, ok := EnvelopeFromContext(ctx); ok && parent.IdempotencyKey != "" {
+		return parent.IdempotencyKey + "/" + eventDigest(eventName, props)
+	}
+	if k := props[IdempotencyKeyProp]; k != "" {
+		return eventName + ":" + k
+	}
+	return eventID
+}
+
+// eventDigest hashes the name and the non envelope properties
+func eventDigest(eventName string, props map[string]string) string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		if !strings.HasPrefix(k, "_") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	h.Write([]byte(eventName))
+	for _, k := range keys {
+		h.Write([]byte{0})
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(props[k]))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -0,0 +1,143 @@
+package eventemitter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+func TestNewEnvelope(t *testing.T) {
+	parent := Envelope{EventID: "parent", CorrelationID: "root", UserID: "parent-user"}
+
+	tests := []struct {
+		name            string
+		ctx             context.Context
+		wantCorrelation string
+		wantCausation   string
+		wantUserID      string
+	}{
+		{name: "root event", ctx: context.Background()},
+		{name: "root event of a user", ctx: context.WithValue(context.Background(), runtime.RUNTIME_CTX_USER_ID, "caller"), wantUserID: "caller"},
+		{name: "child event", ctx: WithEnvelope(context.Background(), parent), wantCorrelation: "root", wantCausation: "parent", wantUserID: "parent-user"},
+		{
+			name:            "child event of another user",
+			ctx:             context.WithValue(WithEnvelope(context.Background(), parent), runtime.RUNTIME_CTX_USER_ID, "caller"),
+			wantCorrelation: "root",
+			wantCausation:   "parent",
+			wantUserID:      "caller",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := NewEnvelope(tt.ctx)
+			if env.EventID == "" || env.SchemaVersion != SchemaVersion || env.EmittedAt.IsZero() {
+				t.Fatalf("NewEnvelope() = %+v, want an id, version and emit time", env)
+			}
+			wantCorrelation := tt.wantCorrelation
+			if wantCorrelation == "" {
+				wantCorrelation = env.EventID
+			}
+			if env.CorrelationID != wantCorrelation || env.CausationID != tt.wantCausation || env.UserID != tt.wantUserID {
+				t.Fatalf("NewEnvelope() = %+v, want correlation %q, causation %q, user %q", env, wantCorrelation, tt.wantCausation, tt.wantUserID)
+			}
+		})
+	}
+}
+
+func TestEnvelopeFromEvent(t *testing.T) {
+	emitted := time.UnixMilli(1741600000123).UTC()
+	env := Envelope{
+		EventID:        "event",
+		SchemaVersion:  SchemaVersion,
+		EmittedAt:      emitted,
+		CorrelationID:  "root",
+		CausationID:    "parent",
+		UserID:         "user",
+		IdempotencyKey: "key",
+	}
+	applied := map[string]string{"score": "10"}
+	env.Apply(applied)
+
+	tests := []struct {
+		name   string
+		props  map[string]string
+		want   Envelope
+		wantOk bool
+	}{
+		{name: "round trip", props: applied, want: env, wantOk: true},
+		{name: "no envelope", props: map[string]string{"score": "10"}},
+		{
+			name:   "correlation and key default to the event id",
+			props:  map[string]string{PropEventID: "event", PropSchemaVersion: "1", PropEmittedAt: "bad"},
+			want:   Envelope{EventID: "event", SchemaVersion: 1, CorrelationID: "event", IdempotencyKey: "event"},
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := EnvelopeFromEvent(&api.Event{Name: "test", Properties: tt.props})
+			if ok != tt.wantOk || got != tt.want {
+				t.Fatalf("EnvelopeFromEvent() = %+v, %t, want %+v, %t", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	parent := WithEnvelope(context.Background(), Envelope{EventID: "parent", IdempotencyKey: "parent-key"})
+	props := map[string]string{"user_id": "u1", "score": "10"}
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		eventName string
+		props     map[string]string
+		want      string
+	}{
+		{name: "event id", ctx: context.Background(), eventName: "scored", props: props, want: "event-id"},
+		{name: "emitter key", ctx: context.Background(), eventName: "scored", props: map[string]string{IdempotencyKeyProp: "k1"}, want: "scored:k1"},
+		{name: "emitter key scoped by name", ctx: context.Background(), eventName: "granted", props: map[string]string{IdempotencyKeyProp: "k1"}, want: "granted:k1"},
+		{name: "parent chain", ctx: parent, eventName: "scored", props: props, want: "parent-key/" + eventDigest("scored", props)},
+		{
+			name:      "parent chain wins over emitter key",
+			ctx:       parent,
+			eventName: "scored",
+			props:     map[string]string{IdempotencyKeyProp: "k1"},
+			want:      "parent-key/" + eventDigest("scored", map[string]string{IdempotencyKeyProp: "k1"}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IdempotencyKey(tt.ctx, tt.eventName, tt.props, "event-id"); got != tt.want {
+				t.Fatalf("IdempotencyKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventDigest(t *testing.T) {
+	base := eventDigest("scored", map[string]string{"user_id": "u1", "score": "10"})
+
+	tests := []struct {
+		name      string
+		eventName string
+		props     map[string]string
+		same      bool
+	}{
+		{name: "same props", eventName: "scored", props: map[string]string{"score": "10", "user_id": "u1"}, same: true},
+		{name: "envelope props ignored", eventName: "scored", props: map[string]string{"user_id": "u1", "score": "10", PropEventID: "x"}, same: true},
+		{name: "other value", eventName: "scored", props: map[string]string{"user_id": "u1", "score": "11"}},
+		{name: "other name", eventName: "granted", props: map[string]string{"user_id": "u1", "score": "10"}},
+		{name: "key and value boundary", eventName: "scored", props: map[string]string{"user_id": "u1", "score1": "0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eventDigest(tt.eventName, tt.props); (got == base) != tt.same {
+				t.Fatalf("eventDigest() = %s, base %s, want same %t", got, base, tt.same)
+			}
+		})
+	}
+}
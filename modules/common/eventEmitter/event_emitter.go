@@ -7,11 +7,25 @@ import (
 	"github.com/heroiclabs/nakama-common/runtime"
 )
 
+// EmitEvent sends the event wrapped in a new envelope, the caller's
+// properties map is left untouched
 func EmitEvent(ctx context.Context, nk runtime.NakamaModule, eventName string, properties map[string]string) error {
-	evt := &api.Event{
+	return nk.Event(ctx, BuildEvent(ctx, eventName, properties))
+}
+
+// BuildEvent returns the event EmitEvent would send
+func BuildEvent(ctx context.Context, eventName string, properties map[string]string) *api.Event {
+	props := make(map[string]string, len(properties)+6)
+	for k, v := range properties {
+		props[k] = v
+	}
+	env := NewEnvelope(ctx)
+	env.IdempotencyKey = IdempotencyKey(ctx, eventName, properties, env.EventID)
+	env.Apply(props)
+
+	return &api.Event{
 		Name:       eventName,
-		Properties: properties,
+		Properties: props,
 		External:   false,
 	}
-	return nk.Event(ctx, evt)
 }
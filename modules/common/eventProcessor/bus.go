@@ -0,0 +1,85 @@
+package eventprocessor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Handler handles a single event, a returned error marks the delivery to
+// that subscriber as failed
+type Handler func(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) error
+
+// Subscription binds a handler to an event name pattern. Patterns are an
+// exact event name, "*" for every event, or a prefix ending in "*" such as
+// "leaderboard_*".
+type Subscription struct {
+	Subscriber string
+	Pattern    string
+	Handler    Handler
+}
+
+func (s Subscription) matches(eventName string) bool {
+	if prefix, ok := strings.CutSuffix(s.Pattern, "*"); ok {
+		return strings.HasPrefix(eventName, prefix)
+	}
+	return s.Pattern == eventName
+}
+
+// Bus keeps the subscriptions of every domain, handlers are dispatched in
+// subscription order
+type Bus struct {
+	mu   sync.RWMutex
+	subs []Subscription
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers handler for the events matching pattern. The
+// subscriber name identifies the handler in logs and must be unique per
+// pattern.
+func (b *Bus) Subscribe(pattern, subscriber string, handler Handler) error {
+	if pattern == "" || subscriber == "" || handler == nil {
+		return fmt.Errorf("pattern, subscriber and handler are required")
+	}
+	if i := strings.Index(pattern, "*"); i >= 0 && i != len(pattern)-1 {
+		return fmt.Errorf("invalid pattern %q, a wildcard is only allowed at the end", pattern)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.subs {
+		if s.Pattern == pattern && s.Subscriber == subscriber {
+			return fmt.Errorf("%s is already subscribed to %q", subscriber, pattern)
+		}
+	}
+	b.subs = append(b.subs, Subscription{Subscriber: subscriber, Pattern: pattern, Handler: handler})
+	return nil
+}
+
+// Subscriptions returns the subscriptions matching eventName
+func (b *Bus) Subscriptions(eventName string) []Subscription {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var matched []Subscription
+	for _, s := range b.subs {
+		if s.matches(eventName) {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+// the bus every domain subscribes to from its InitModule
+var defaultBus = NewBus()
+
+// Subscribe registers handler on the shared bus, see Bus.Subscribe
+func Subscribe(pattern, subscriber string, handler Handler) error {
+	return defaultBus.Subscribe(pattern, subscriber, handler)
+}
@@ -0,0 +1,174 @@
+package eventprocessor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+	"github.com/titan/titan-runtime/modules/common/schema"
+)
+
+// ---- dead-letter queue ----
+// deliveries that failed permanently or ran out of retries are kept as
+// system owned storage objects, one per (event, subscriber), until an
+// admin replays or discards them
+
+const deadLetterCollection = "event_dead_letters"
+
+var errDeadLetterNotFound = errors.New("dead letter not found")
+
+type DeadLetter struct {
+	ID         string            `json:"id"`
+	EventName  string            `json:"event_name"`
+	Properties map[string]string `json:"properties"`
+	Subscriber string            `json:"subscriber"`
+	Pattern    string            `json:"pattern"`
+	Error      string            `json:"error"`
+	// ValidationErrors is set when the event broke its schema
+	ValidationErrors []schema.FieldError `json:"validation_errors,omitempty"`
+	Permanent        bool                `json:"permanent"`
+	Attempts         int                 `json:"attempts"`
+	Replays          int                 `json:"replays"`
+	FailedAt         int64               `json:"failed_at"`
+}
+
+func deadLetterID(eventID, subscriber string) string {
+	return eventID + ":" + subscriber
+}
+
+func (d *DeadLetter) event() *api.Event {
+	return &api.Event{Name: d.EventName, Properties: d.Properties}
+}
+
+func writeDeadLetter(ctx context.Context, nk runtime.NakamaModule, d *DeadLetter) error {
+	value, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      deadLetterCollection,
+		Key:             d.ID,
+		Value:           string(value),
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	return err
+}
+
+func readDeadLetter(ctx context.Context, nk runtime.NakamaModule, id string) (*DeadLetter, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: deadLetterCollection,
+		Key:        id,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, errDeadLetterNotFound
+	}
+	var d DeadLetter
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func listDeadLetters(ctx context.Context, nk runtime.NakamaModule, limit int, cursor string) ([]*DeadLetter, string, error) {
+	objects, nextCursor, err := nk.StorageList(ctx, "", "", deadLetterCollection, limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	letters := make([]*DeadLetter, 0, len(objects))
+	for _, o := range objects {
+		var d DeadLetter
+		if err := json.Unmarshal([]byte(o.GetValue()), &d); err != nil {
+			return nil, "", err
+		}
+		letters = append(letters, &d)
+	}
+	return letters, nextCursor, nil
+}
+
+func deleteDeadLetter(ctx context.Context, nk runtime.NakamaModule, id string) error {
+	return nk.StorageDelete(ctx, []*runtime.StorageDelete{{
+		Collection: deadLetterCollection,
+		Key:        id,
+	}})
+}
+
+// deadLetter persists a failed delivery, when even that fails the event is
+// logged in full so it can be recovered from the logs
+func deadLetter(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, sub Subscription, evt *api.Event, eventID string, attempts int, cause error) {
+	d := &DeadLetter{
+		ID:         deadLetterID(eventID, sub.Subscriber),
+		EventName:  evt.GetName(),
+		Properties: evt.GetProperties(),
+		Subscriber: sub.Subscriber,
+		Pattern:    sub.Pattern,
+		Error:      cause.Error(),
+		Permanent:  IsPermanent(cause),
+		Attempts:   attempts,
+		FailedAt:   time.Now().Unix(),
+	}
+	var verr *schema.ValidationError
+	if errors.As(cause, &verr) {
+		d.ValidationErrors = verr.Errors
+	}
+	nk.MetricsCounterAdd("event_dead_letters", map[string]string{"event": d.EventName, "subscriber": d.Subscriber}, 1)
+	if err := writeDeadLetter(ctx, nk, d); err != nil {
+		logger.WithFields(map[string]interface{}{
+			"event":      d.EventName,
+			"subscriber": d.Subscriber,
+			"properties": d.Properties,
+		}).Error("failed to dead-letter event: %v (handler error: %v)", err, cause)
+		return
+	}
+	logger.Error("%s event dead-lettered as %s after %d attempts: %v", d.EventName, d.ID, attempts, cause)
+}
+
+// replayDeadLetter delivers the event to its subscriber again, with the
+// usual retries. The dead letter is removed on success and updated with
+// the new error otherwise.
+func replayDeadLetter(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, d *DeadLetter) error {
+	var sub *Subscription
+	for _, s := range defaultBus.Subscriptions(d.EventName) {
+		if s.Subscriber == d.Subscriber && s.Pattern == d.Pattern {
+			sub = &s
+			break
+		}
+	}
+	if sub == nil {
+		return errors.New("subscriber " + d.Subscriber + " is no longer subscribed to " + d.EventName)
+	}
+
+	evt := d.event()
+	env := envelopeFor(ctx, evt)
+	attempts := 0
+	err := validateEvent(evt)
+	if err == nil {
+		attempts, err = deliver(eventEmitter.WithEnvelope(ctx, env), logger, nk, *sub, evt)
+	}
+	if err == nil {
+		logger.Info("dead letter %s replayed", d.ID)
+		return deleteDeadLetter(ctx, nk, d.ID)
+	}
+
+	d.Error = err.Error()
+	d.ValidationErrors = nil
+	var verr *schema.ValidationError
+	if errors.As(err, &verr) {
+		d.ValidationErrors = verr.Errors
+	}
+	d.Permanent = IsPermanent(err)
+	d.Attempts += attempts
+	d.Replays++
+	d.FailedAt = time.Now().Unix()
+	if writeErr := writeDeadLetter(ctx, nk, d); writeErr != nil {
+		logger.Error("failed to update dead letter %s: %v", d.ID, writeErr)
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package eventprocessor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/config"
+	"github.com/titan/titan-runtime/modules/utils"
+)
+
+// ---- deduplication store ----
+// every idempotency key is claimed before dispatch, a key that is already
+// claimed and not yet expired marks a duplicate delivery. Claims live in
+// a table of their own so they are shared by every Nakama node.
+//
+// A claim is processing until the handlers are done and only then kept for
+// the ttl. A processing claim expires after processingTimeout, so an event
+// whose node crashed mid-dispatch is processed again when redelivered.
+
+const (
+	dedupTTLEnv        = "EVENT_DEDUP_TTL"
+	defaultDedupTTL    = 24 * time.Hour
+	dedupPurgeInterval = 10 * time.Minute
+	// longer than a dispatch with all its retries takes
+	processingTimeout = 5 * time.Minute
+
+	dedupStatusProcessing = "processing"
+	dedupStatusDone       = "done"
+)
+
+const createDedupTableQuery = `
+CREATE TABLE IF NOT EXISTS titan_event_dedup (
+	idempotency_key VARCHAR(512) PRIMARY KEY,
+	event_name      VARCHAR(128) NOT NULL,
+	status          VARCHAR(16)  NOT NULL DEFAULT 'done',
+	expires_at      TIMESTAMPTZ  NOT NULL
+)`
+
+// claims made before the status existed were done
+const migrateDedupTableQuery = `
+ALTER TABLE titan_event_dedup ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'done'`
+
+// an expired claim is taken over, a live one returns no row. A processing
+// claim expires at its processing deadline.
+const claimDedupKeyQuery = `
+INSERT INTO titan_event_dedup (idempotency_key, event_name, status, expires_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (idempotency_key) DO UPDATE
+	SET event_name = EXCLUDED.event_name, status = EXCLUDED.status, expires_at = EXCLUDED.expires_at
+	WHERE titan_event_dedup.expires_at < now()
+RETURNING idempotency_key`
+
+const completeDedupKeyQuery = `
+UPDATE titan_event_dedup SET status = $2, expires_at = $3 WHERE idempotency_key = $1`
+
+const purgeDedupKeysQuery = `DELETE FROM titan_event_dedup WHERE expires_at < now()`
+
+type dedupStore struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+func newDedupStore(ctx context.Context, logger runtime.Logger, db *sql.DB) (*dedupStore, error) {
+	ttl := defaultDedupTTL
+	if v := config.Env(ctx, dedupTTLEnv, ""); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, errors.New("invalid " + dedupTTLEnv + ": " + v)
+		}
+		ttl = d
+	}
+	if _, err := db.ExecContext(ctx, createDedupTableQuery); err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, migrateDedupTableQuery); err != nil {
+		return nil, err
+	}
+	logger.Info("event deduplication enabled with ttl %s", ttl)
+	return &dedupStore{db: db, ttl: ttl}, nil
+}
+
+// claim reports whether the key was free, i.e. the event is not a duplicate.
+// The claim is processing until complete is called.
+func (s *dedupStore) claim(ctx context.Context, key, eventName string) (bool, error) {
+	var claimed string
+	err := s.db.QueryRowContext(ctx, claimDedupKeyQuery, key, eventName, dedupStatusProcessing, time.Now().Add(processingTimeout)).Scan(&claimed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// complete marks a claimed key as processed, it's kept for the ttl
+func (s *dedupStore) complete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, completeDedupKeyQuery, key, dedupStatusDone, time.Now().Add(s.ttl))
+	return err
+}
+
+// startPurge removes expired claims in the background
+func (s *dedupStore) startPurge(ctx context.Context, logger runtime.Logger) {
+	go func() {
+		ticker := time.NewTicker(dedupPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				utils.SpawnSafe(ctx, logger, func(ctx context.Context) {
+					if _, err := s.db.ExecContext(ctx, purgeDedupKeysQuery); err != nil {
+						logger.Warn("failed to purge expired event dedup keys: %v", err)
+					}
+				})
+			}
+		}
+	}()
+}
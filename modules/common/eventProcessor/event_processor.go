@@ -6,33 +6,141 @@ import (
 
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
-	"github.com/titan/titan-runtime/modules/account"
-	"github.com/titan/titan-runtime/modules/leaderboard"
+	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+	"github.com/titan/titan-runtime/modules/common/rpc"
+	"github.com/titan/titan-runtime/modules/common/schema"
+	"github.com/titan/titan-runtime/modules/utils"
 )
 
 func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
 	logger.Info("Initializing EventProcessor domain...")
-	if err := initializer.RegisterEvent(ProcessEvent(nk, db)); err != nil {
+	dedup, err := newDedupStore(ctx, logger, db)
+	if err != nil {
+		return err
+	}
+	dedup.startPurge(ctx, logger)
+
+	if err := initializer.RegisterEvent(processEvent(nk, dedup)); err != nil {
+		return err
+	}
+	// a replay retries with the event's backoff, so it gets a longer deadline
+	router := rpc.NewRouter(initializer).Use(rpc.ServerOnly)
+	if err := router.Register("list_dead_letters", ListDeadLettersHandler, rpc.Timeout(deadLetterRPCTimeout)); err != nil {
+		return err
+	}
+	if err := router.Register("get_dead_letter", GetDeadLetterHandler, rpc.Timeout(deadLetterRPCTimeout)); err != nil {
+		return err
+	}
+	if err := router.Register("replay_dead_letter", ReplayDeadLetterHandler, rpc.Timeout(replayRPCTimeout)); err != nil {
+		return err
+	}
+	if err := router.Register("discard_dead_letter", DiscardDeadLetterHandler, rpc.Timeout(deadLetterRPCTimeout)); err != nil {
 		return err
 	}
 	logger.Info("EventProcessor domain initialized")
 	return nil
 }
 
-func ProcessEvent(nk runtime.NakamaModule, db *sql.DB) func(ctx context.Context, logger runtime.Logger, evt *api.Event) {
+// processEvent dispatches every event to the handlers the domains
+// subscribed in their InitModule. Handlers read the event envelope with
+// eventEmitter.EnvelopeFromContext, and events they emit join its chain.
+// Events whose idempotency key was already processed, or is being
+// processed, are dropped. The key is only marked processed once every
+// subscriber was dispatched, see dedup.go. Client events are dropped
+// unless their name is allowed, see external.go.
+func processEvent(nk runtime.NakamaModule, dedup *dedupStore) func(ctx context.Context, logger runtime.Logger, evt *api.Event) {
 	return func(ctx context.Context, logger runtime.Logger, evt *api.Event) {
-		switch evt.GetName() {
-		case "account_updated":
-			logger.Debug("[WORKER]account_updated event received")
-			account.HandleAccountUpdatedEvent(ctx, logger, evt)
-		case "profile_updated":
-			logger.Debug("[WORKER]profile_updated event received")
-			// profile.HandleProfileUpdatedEvent(ctx, logger, evt)
-		case "update_leaderboard":
-			logger.Debug("[WORKER]update_leaderboard event received")
-			leaderboard.HandleUpdateLeaderboardEvent(ctx, logger, nk, evt)
+		if evt.GetExternal() {
+			if !isExternalAllowed(evt.GetName()) {
+				logger.Warn("dropping external %s event from %s, it isn't allowed from clients", evt.GetName(), utils.UserID(ctx))
+				nk.MetricsCounterAdd("event_external_rejected", map[string]string{"event": evt.GetName()}, 1)
+				return
+			}
+			stripReserved(evt)
+		}
+		env := envelopeFor(ctx, evt)
+		ctx = eventEmitter.WithEnvelope(ctx, env)
+		logger = logger.WithFields(map[string]interface{}{
+			"event_id":       env.EventID,
+			"correlation_id": env.CorrelationID,
+		})
+
+		// on store errors the event is processed anyway, losing it would be
+		// worse than the rare double delivery
+		claimed, err := dedup.claim(ctx, env.IdempotencyKey, evt.GetName())
+		switch {
+		case err != nil:
+			logger.Error("failed to check idempotency key %s: %v", env.IdempotencyKey, err)
+			nk.MetricsCounterAdd("event_dedup_errors", map[string]string{"event": evt.GetName()}, 1)
+		case !claimed:
+			logger.Info("dropping duplicate %s event (idempotency key %s)", evt.GetName(), env.IdempotencyKey)
+			nk.MetricsCounterAdd("event_duplicates_dropped", map[string]string{"event": evt.GetName()}, 1)
+			return
 		default:
+			defer func() {
+				if err := dedup.complete(context.WithoutCancel(ctx), env.IdempotencyKey); err != nil {
+					logger.Error("failed to complete idempotency key %s: %v", env.IdempotencyKey, err)
+					nk.MetricsCounterAdd("event_dedup_errors", map[string]string{"event": evt.GetName()}, 1)
+				}
+			}()
+		}
+
+		subs := defaultBus.Subscriptions(evt.GetName())
+		if len(subs) == 0 {
 			logger.Error("unrecognized event: %+v", evt)
+			return
 		}
+		// events breaking their schema never reach a handler, they're
+		// dead-lettered for every subscriber so they can be replayed once
+		// fixed
+		if err := validateEvent(evt); err != nil {
+			nk.MetricsCounterAdd("event_schema_rejections", map[string]string{"event": evt.GetName()}, 1)
+			for _, sub := range subs {
+				deadLetter(ctx, logger, nk, sub, evt, env.EventID, 0, err)
+			}
+			return
+		}
+
+		// a failing subscriber doesn't stop the others, each failed
+		// delivery is dead-lettered on its own
+		for _, sub := range subs {
+			logger.Debug("[WORKER]%s event received by %s", evt.GetName(), sub.Subscriber)
+			if attempts, err := deliver(ctx, logger, nk, sub, evt); err != nil {
+				deadLetter(ctx, logger, nk, sub, evt, env.EventID, attempts, err)
+			}
+		}
+	}
+}
+
+// envelopeFor returns the envelope of evt. Events that weren't emitted
+// through EmitEvent, e.g. external ones, get a fresh envelope so handlers
+// can rely on it. The key of an external event is scoped by its sender, so
+// a client can't claim the key of a server event or another user's.
+func envelopeFor(ctx context.Context, evt *api.Event) eventEmitter.Envelope {
+	if env, ok := eventEmitter.EnvelopeFromEvent(evt); ok {
+		return env
+	}
+
+	env := eventEmitter.NewEnvelope(context.Background())
+	env.IdempotencyKey = eventEmitter.IdempotencyKey(context.Background(), evt.GetName(), evt.GetProperties(), env.EventID)
+	if evt.GetExternal() {
+		env.UserID = utils.UserID(ctx)
+		env.IdempotencyKey = "external:" + env.UserID + ":" + env.IdempotencyKey
+	}
+	if ts := evt.GetTimestamp(); ts != nil {
+		env.EmittedAt = ts.AsTime()
 	}
+	if evt.Properties == nil {
+		evt.Properties = make(map[string]string)
+	}
+	env.Apply(evt.Properties)
+	return env
+}
+
+// validateEvent checks evt against its schema, a violation is permanent
+func validateEvent(evt *api.Event) error {
+	if err := schema.Validate(evt.GetName(), evt.GetProperties()); err != nil {
+		return Permanent(err)
+	}
+	return nil
 }
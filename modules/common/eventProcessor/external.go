@@ -0,0 +1,42 @@
+package eventprocessor
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/api"
+)
+
+// ---- external events ----
+// clients can post any event through nakama's event api, those arrive with
+// External set. They're only dispatched when a domain allowed their name
+// with AllowExternal, and lose their reserved "_" properties first so a
+// client can't forge an envelope or an idempotency key.
+
+var (
+	externalMu      sync.RWMutex
+	externalAllowed = make(map[string]bool)
+)
+
+// AllowExternal lets clients send eventName, its handlers must treat the
+// properties as untrusted input
+func AllowExternal(eventName string) {
+	externalMu.Lock()
+	defer externalMu.Unlock()
+	externalAllowed[eventName] = true
+}
+
+func isExternalAllowed(eventName string) bool {
+	externalMu.RLock()
+	defer externalMu.RUnlock()
+	return externalAllowed[eventName]
+}
+
+// stripReserved drops the reserved properties of a client event
+func stripReserved(evt *api.Event) {
+	for k := range evt.Properties {
+		if strings.HasPrefix(k, "_") {
+			delete(evt.Properties, k)
+		}
+	}
+}
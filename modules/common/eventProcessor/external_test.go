@@ -0,0 +1,99 @@
+package eventprocessor
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+)
+
+type testLogger struct{}
+
+func (testLogger) Debug(string, ...interface{})                       {}
+func (testLogger) Info(string, ...interface{})                        {}
+func (testLogger) Warn(string, ...interface{})                        {}
+func (testLogger) Error(string, ...interface{})                       {}
+func (l testLogger) WithField(string, interface{}) runtime.Logger     { return l }
+func (l testLogger) WithFields(map[string]interface{}) runtime.Logger { return l }
+func (testLogger) Fields() map[string]interface{}                     { return nil }
+
+// testNakama only implements the metrics the processor reports
+type testNakama struct {
+	runtime.NakamaModule
+	counters map[string]int64
+}
+
+func (n *testNakama) MetricsCounterAdd(name string, _ map[string]string, delta int64) {
+	n.counters[name] += delta
+}
+
+func TestProcessEventDropsExternalEvents(t *testing.T) {
+	delivered := 0
+	if err := Subscribe("test_client_only", "test", func(context.Context, runtime.Logger, runtime.NakamaModule, *api.Event) error {
+		delivered++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	nk := &testNakama{counters: make(map[string]int64)}
+	ctx := context.WithValue(context.Background(), runtime.RUNTIME_CTX_USER_ID, "client")
+	processEvent(nk, nil)(ctx, testLogger{}, &api.Event{Name: "test_client_only", External: true})
+
+	if delivered != 0 {
+		t.Fatalf("external event was delivered %d times, want 0", delivered)
+	}
+	if nk.counters["event_external_rejected"] != 1 {
+		t.Fatalf("event_external_rejected = %d, want 1", nk.counters["event_external_rejected"])
+	}
+}
+
+func TestEnvelopeForExternal(t *testing.T) {
+	ctx := context.WithValue(context.Background(), runtime.RUNTIME_CTX_USER_ID, "client")
+
+	tests := []struct {
+		name      string
+		props     map[string]string
+		wantKey   string
+		keyPrefix string
+	}{
+		{
+			name: "forged envelope",
+			props: map[string]string{
+				eventEmitter.PropEventID:     "forged-id",
+				eventEmitter.PropIdempotency: "schedule:s1:1741600000",
+				eventEmitter.PropUserID:      "victim",
+			},
+			keyPrefix: "external:client:",
+		},
+		{
+			name:    "client key",
+			props:   map[string]string{eventEmitter.IdempotencyKeyProp: "schedule:s1:1741600000"},
+			wantKey: "external:client:test_event:schedule:s1:1741600000",
+		},
+		{name: "no key", props: map[string]string{"score": "1"}, keyPrefix: "external:client:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evt := &api.Event{Name: "test_event", External: true, Properties: tt.props}
+			stripReserved(evt)
+			env := envelopeFor(ctx, evt)
+
+			if env.EventID == "forged-id" || env.UserID != "client" {
+				t.Fatalf("envelope = %+v, want a fresh id and the sender as user", env)
+			}
+			if tt.wantKey != "" && env.IdempotencyKey != tt.wantKey {
+				t.Fatalf("idempotency key = %q, want %q", env.IdempotencyKey, tt.wantKey)
+			}
+			if tt.keyPrefix != "" && (!strings.HasPrefix(env.IdempotencyKey, tt.keyPrefix) || strings.Contains(env.IdempotencyKey, "schedule:")) {
+				t.Fatalf("idempotency key = %q, want a fresh key under %q", env.IdempotencyKey, tt.keyPrefix)
+			}
+			if evt.Properties[eventEmitter.PropIdempotency] != env.IdempotencyKey {
+				t.Fatalf("event key = %q, want the envelope key %q", evt.Properties[eventEmitter.PropIdempotency], env.IdempotencyKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package eventprocessor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// RetryPolicy controls how often a failing handler is retried for an
+// event type, the delay grows by Multiplier after every attempt
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// DefaultRetryPolicy applies to event types without a policy of their own
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Multiplier:     2,
+}
+
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts < 1 {
+		return errors.New("max attempts must be at least 1")
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < p.InitialBackoff {
+		return errors.New("backoff must satisfy 0 <= initial <= max")
+	}
+	if p.Multiplier < 1 {
+		return errors.New("multiplier must be at least 1")
+	}
+	return nil
+}
+
+// backoff returns the delay before the given (1 based) retry
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		d *= p.Multiplier
+		if d >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	return time.Duration(d)
+}
+
+var (
+	retryPoliciesMu sync.RWMutex
+	retryPolicies   = make(map[string]RetryPolicy)
+)
+
+// SetRetryPolicy sets the retry policy for the handlers of eventName
+func SetRetryPolicy(eventName string, policy RetryPolicy) error {
+	if err := policy.validate(); err != nil {
+		return fmt.Errorf("invalid retry policy for %s: %w", eventName, err)
+	}
+	retryPoliciesMu.Lock()
+	defer retryPoliciesMu.Unlock()
+	retryPolicies[eventName] = policy
+	return nil
+}
+
+func retryPolicyFor(eventName string) RetryPolicy {
+	retryPoliciesMu.RLock()
+	defer retryPoliciesMu.RUnlock()
+	if p, ok := retryPolicies[eventName]; ok {
+		return p
+	}
+	return DefaultRetryPolicy
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a handler error that retrying can't fix, e.g. invalid
+// input. Such events go to the dead-letter queue right away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// deliver runs the handler until it succeeds, fails permanently or the
+// policy runs out of attempts; it returns the attempts made and the last error
+func deliver(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, sub Subscription, evt *api.Event) (int, error) {
+	policy := retryPolicyFor(evt.GetName())
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = sub.Handler(ctx, logger, nk, evt); err == nil {
+			return attempt, nil
+		}
+		if IsPermanent(err) || attempt >= policy.MaxAttempts {
+			return attempt, err
+		}
+
+		delay := policy.backoff(attempt)
+		logger.Warn("%s failed to handle %s (attempt %d/%d), retrying in %s: %v",
+			sub.Subscriber, evt.GetName(), attempt, policy.MaxAttempts, delay, err)
+		select {
+		case <-ctx.Done():
+			return attempt, fmt.Errorf("%w (retry aborted: %v)", err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package eventprocessor
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/common/validation"
+	shared "github.com/titan/titan-runtime/shared"
+)
+
+const (
+	defaultDeadLetterLimit = 50
+	maxDeadLetterLimit     = 100
+
+	deadLetterRPCTimeout = 10 * time.Second
+	replayRPCTimeout     = time.Minute
+)
+
+type deadLetterRequest struct {
+	ID string `json:"id" validate:"required"`
+}
+
+type listDeadLettersRequest struct {
+	Limit  int    `json:"limit" validate:"min=0"`
+	Cursor string `json:"cursor"`
+}
+
+type listDeadLettersResponse struct {
+	DeadLetters []*DeadLetter `json:"dead_letters"`
+	Cursor      string        `json:"cursor,omitempty"`
+}
+
+func deadLetterError(logger runtime.Logger, err error) error {
+	if errors.Is(err, errDeadLetterNotFound) {
+		return runtime.NewError(err.Error(), shared.NOT_FOUND)
+	}
+	logger.Error("dead letter operation failed: %v", err)
+	return shared.ErrInternalError
+}
+
+// parseDeadLetterRequest decodes the id payload used by the single dead
+// letter rpcs
+func parseDeadLetterRequest(payload string) (*deadLetterRequest, error) {
+	var req deadLetterRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func ListDeadLettersHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req listDeadLettersRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return "", err
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultDeadLetterLimit
+	}
+	if req.Limit > maxDeadLetterLimit {
+		req.Limit = maxDeadLetterLimit
+	}
+
+	letters, cursor, err := listDeadLetters(ctx, nk, req.Limit, req.Cursor)
+	if err != nil {
+		return "", deadLetterError(logger, err)
+	}
+
+	responseJSON, err := json.Marshal(listDeadLettersResponse{DeadLetters: letters, Cursor: cursor})
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
+
+func GetDeadLetterHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	req, err := parseDeadLetterRequest(payload)
+	if err != nil {
+		return "", err
+	}
+	d, err := readDeadLetter(ctx, nk, req.ID)
+	if err != nil {
+		return "", deadLetterError(logger, err)
+	}
+
+	responseJSON, err := json.Marshal(d)
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
+
+// ReplayDeadLetterHandler hands the event to its subscriber again; the
+// idempotency check is skipped since the key was claimed by the failed run
+func ReplayDeadLetterHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	req, err := parseDeadLetterRequest(payload)
+	if err != nil {
+		return "", err
+	}
+	d, err := readDeadLetter(ctx, nk, req.ID)
+	if err != nil {
+		return "", deadLetterError(logger, err)
+	}
+	if err := replayDeadLetter(ctx, logger, nk, d); err != nil {
+		return "", runtime.NewError("replay failed: "+err.Error(), shared.ABORTED)
+	}
+	return `{"status":"replayed"}`, nil
+}
+
+func DiscardDeadLetterHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	req, err := parseDeadLetterRequest(payload)
+	if err != nil {
+		return "", err
+	}
+	if _, err := readDeadLetter(ctx, nk, req.ID); err != nil {
+		return "", deadLetterError(logger, err)
+	}
+	if err := deleteDeadLetter(ctx, nk, req.ID); err != nil {
+		return "", deadLetterError(logger, err)
+	}
+	logger.Info("dead letter %s discarded", req.ID)
+	return `{"status":"discarded"}`, nil
+}
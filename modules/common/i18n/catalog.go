@@ -0,0 +1,181 @@
+package i18n
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ---- message catalogs ----
+// a catalog holds the messages of one locale keyed by their english source
+// text, gettext style, so a missing translation falls back to the source.
+// A message has one form per plural form of the locale.
+//
+// JSON catalogs map the source to a string, or to an object of plural
+// forms for plural messages:
+//
+//	{"Login reward": "Recompensa diaria",
+//	 "{{.count}} day": {"one": "{{.count}} día", "other": "{{.count}} días"}}
+//
+// PO catalogs use msgid/msgstr, and msgid_plural/msgstr[n] with n as the
+// gettext plural index. Fuzzy entries are skipped.
+
+type Catalog struct {
+	Locale   string
+	messages map[string][]string
+}
+
+func newCatalog(locale string) *Catalog {
+	return &Catalog{Locale: locale, messages: make(map[string][]string)}
+}
+
+// Len is the number of messages of the catalog
+func (c *Catalog) Len() int {
+	return len(c.messages)
+}
+
+func (c *Catalog) add(msgid string, forms []string) {
+	for _, f := range forms {
+		if f != "" {
+			c.messages[msgid] = forms
+			return
+		}
+	}
+}
+
+// ParseJSON parses a JSON catalog of locale
+func ParseJSON(locale string, data []byte) (*Catalog, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	rule := pluralRuleFor(locale)
+	c := newCatalog(locale)
+	for msgid, value := range raw {
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			c.add(msgid, []string{s})
+			continue
+		}
+		var plural map[string]string
+		if err := json.Unmarshal(value, &plural); err != nil {
+			return nil, fmt.Errorf("message %q must be a string or an object of plural forms", msgid)
+		}
+		forms := make([]string, len(rule.forms))
+		for form, text := range plural {
+			i := indexOf(rule.forms, form)
+			if i < 0 {
+				return nil, fmt.Errorf("message %q has plural form %q, %s uses %v", msgid, form, locale, rule.forms)
+			}
+			forms[i] = text
+		}
+		c.add(msgid, forms)
+	}
+	return c, nil
+}
+
+// ParsePO parses a gettext PO catalog of locale
+func ParsePO(locale string, data []byte) (*Catalog, error) {
+	c := newCatalog(locale)
+	var (
+		msgid, plural string
+		forms         []string
+		fuzzy         bool
+		// the string continued by the following quoted lines
+		target *string
+	)
+	// an entry ends when the next one starts with a comment, msgctxt or
+	// msgid after its msgstr
+	next := func() {
+		if forms == nil {
+			return
+		}
+		// the header is the entry with an empty msgid
+		if msgid != "" && !fuzzy {
+			if plural == "" {
+				forms = forms[:1]
+			}
+			c.add(msgid, forms)
+		}
+		msgid, plural, forms, fuzzy, target = "", "", nil, false, nil
+	}
+	form := func(i int) *string {
+		for len(forms) <= i {
+			forms = append(forms, "")
+		}
+		return &forms[i]
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			next()
+			if strings.HasPrefix(line, "#,") && strings.Contains(line, "fuzzy") {
+				fuzzy = true
+			}
+			continue
+		case strings.HasPrefix(line, `"`):
+			if target == nil {
+				return nil, fmt.Errorf("line %d: string outside of an entry", n)
+			}
+			s, err := strconv.Unquote(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			*target += s
+			continue
+		}
+
+		keyword, rest, _ := strings.Cut(line, " ")
+		value, err := strconv.Unquote(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		switch {
+		case keyword == "msgctxt":
+			// contexts aren't used, messages are told apart by their msgid
+			next()
+			target = new(string)
+		case keyword == "msgid":
+			next()
+			msgid = value
+			target = &msgid
+		case keyword == "msgid_plural":
+			plural = value
+			target = &plural
+		case keyword == "msgstr":
+			target = form(0)
+			*target = value
+		case strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]"):
+			i, err := strconv.Atoi(keyword[len("msgstr[") : len(keyword)-1])
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("line %d: invalid plural index %q", n, keyword)
+			}
+			target = form(i)
+			*target = value
+		default:
+			return nil, fmt.Errorf("line %d: unknown keyword %q", n, keyword)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	next()
+	return c, nil
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,249 @@
+package i18n
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/config"
+)
+
+// ---- i18n ----
+// user-facing strings are written in english in the code and translated
+// through the catalogs of the locales directory, <locale>.json or
+// <locale>.po. A locale is looked up along its fallback chain: the locale,
+// its parents (pt-BR, pt), the fallbacks configured in i18n.json and the
+// default locale, and the english source is used when none has it.
+
+const (
+	pathEnv     = "I18N_PATH"
+	defaultPath = "modules/common/i18n/locales"
+
+	configFile = "i18n.json"
+	// DefaultLocale is the locale of the source strings
+	DefaultLocale = "en"
+)
+
+type Config struct {
+	// Default is the last locale of every chain
+	Default string `json:"default"`
+	// Fallbacks are tried after a locale and its parents, e.g.
+	// {"ca": ["es"]}
+	Fallbacks map[string][]string `json:"fallbacks"`
+}
+
+type Bundle struct {
+	config   Config
+	catalogs map[string]*Catalog
+}
+
+// NewBundle returns a bundle of catalogs, keyed by their locale
+func NewBundle(cfg Config, catalogs ...*Catalog) *Bundle {
+	b := &Bundle{config: cfg, catalogs: make(map[string]*Catalog)}
+	if b.config.Default == "" {
+		b.config.Default = DefaultLocale
+	}
+	for _, c := range catalogs {
+		b.catalogs[Normalize(c.Locale)] = c
+	}
+	return b
+}
+
+// Locales lists the locales with a catalog
+func (b *Bundle) Locales() []string {
+	locales := make([]string, 0, len(b.catalogs))
+	for l := range b.catalogs {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Chain is the fallback chain of locale
+func (b *Bundle) Chain(locale string) []string {
+	var chain []string
+	add := func(l string) {
+		if l == "" {
+			return
+		}
+		for _, c := range chain {
+			if c == l {
+				return
+			}
+		}
+		chain = append(chain, l)
+	}
+	var walk func(l string, depth int)
+	walk = func(l string, depth int) {
+		for ; l != ""; l = parent(l) {
+			add(l)
+			if depth < 3 {
+				for _, f := range b.config.Fallbacks[l] {
+					walk(Normalize(f), depth+1)
+				}
+			}
+		}
+	}
+	walk(Normalize(locale), 0)
+	add(Normalize(b.config.Default))
+	return chain
+}
+
+// T translates msgid to locale
+func (b *Bundle) T(locale, msgid string) string {
+	for _, l := range b.Chain(locale) {
+		if c, ok := b.catalogs[l]; ok {
+			if forms, ok := c.messages[msgid]; ok && forms[0] != "" {
+				return forms[0]
+			}
+		}
+	}
+	return msgid
+}
+
+// N translates the plural message msgid, plural is the english plural
+// form used when no locale of the chain has it
+func (b *Bundle) N(locale, msgid, plural string, n int) string {
+	for _, l := range b.Chain(locale) {
+		c, ok := b.catalogs[l]
+		if !ok {
+			continue
+		}
+		forms, ok := c.messages[msgid]
+		if !ok {
+			continue
+		}
+		if i := pluralRuleFor(l).index(n); i < len(forms) && forms[i] != "" {
+			return forms[i]
+		}
+	}
+	if n == 1 || plural == "" {
+		return msgid
+	}
+	return plural
+}
+
+// LoadDir loads the config and the catalogs of dir
+func LoadDir(dir string) (*Bundle, error) {
+	var cfg Config
+	data, err := os.ReadFile(filepath.Join(dir, configFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", configFile, err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var catalogs []*Catalog
+	for _, e := range entries {
+		name := e.Name()
+		ext := filepath.Ext(name)
+		if e.IsDir() || name == configFile || (ext != ".json" && ext != ".po") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		locale := Normalize(strings.TrimSuffix(name, ext))
+		parse := ParseJSON
+		if ext == ".po" {
+			parse = ParsePO
+		}
+		c, err := parse(locale, data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid catalog %s: %w", name, err)
+		}
+		catalogs = append(catalogs, c)
+	}
+	return NewBundle(cfg, catalogs...), nil
+}
+
+// Normalize returns locale as a BCP 47 tag, "pt_br" is "pt-BR"
+func Normalize(locale string) string {
+	parts := strings.FieldsFunc(strings.TrimSpace(locale), func(r rune) bool { return r == '-' || r == '_' })
+	for i, p := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(p)
+		case len(p) == 2:
+			parts[i] = strings.ToUpper(p)
+		case len(p) == 4:
+			parts[i] = strings.ToUpper(p[:1]) + strings.ToLower(p[1:])
+		default:
+			parts[i] = strings.ToLower(p)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// parent drops the last subtag of locale, "" for a bare language
+func parent(locale string) string {
+	if i := strings.LastIndex(locale, "-"); i > 0 {
+		return locale[:i]
+	}
+	return ""
+}
+
+func language(locale string) string {
+	l := Normalize(locale)
+	if i := strings.Index(l, "-"); i > 0 {
+		return l[:i]
+	}
+	return l
+}
+
+var (
+	bundleMu sync.RWMutex
+	active   = NewBundle(Config{})
+)
+
+func current() *Bundle {
+	bundleMu.RLock()
+	defer bundleMu.RUnlock()
+	return active
+}
+
+// SetBundle replaces the active catalogs
+func SetBundle(b *Bundle) {
+	bundleMu.Lock()
+	defer bundleMu.Unlock()
+	active = b
+}
+
+// T translates msgid to locale with the active catalogs
+func T(locale, msgid string) string {
+	return current().T(locale, msgid)
+}
+
+// N translates a plural message to locale with the active catalogs
+func N(locale, msgid, plural string, n int) string {
+	return current().N(locale, msgid, plural, n)
+}
+
+func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	logger.Info("Initializing i18n...")
+	dir := config.Env(ctx, pathEnv, defaultPath)
+	b, err := LoadDir(dir)
+	if err != nil {
+		return err
+	}
+	SetBundle(b)
+	logger.Info("i18n initialized with locales %v, default %s", b.Locales(), b.config.Default)
+	return nil
+}
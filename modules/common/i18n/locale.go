@@ -0,0 +1,85 @@
+package i18n
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/common/services"
+	"github.com/titan/titan-runtime/modules/utils"
+)
+
+// ---- user locales ----
+// the locale of a user is the LangTag of their account. It's cached for a
+// while since every notification and rpc error needs it, profile updates
+// drop it with Forget.
+
+const (
+	localeTTL = 10 * time.Minute
+	// the cache is cleared of expired locales when it grows past this
+	maxCachedLocales = 50000
+)
+
+type cachedLocale struct {
+	locale  string
+	expires time.Time
+}
+
+var (
+	localesMu sync.Mutex
+	locales   = make(map[string]cachedLocale)
+)
+
+// UserLocale returns the locale of userID, the default locale when it
+// can't be resolved
+func UserLocale(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, userID string) string {
+	if userID == "" {
+		return current().config.Default
+	}
+	now := time.Now()
+	localesMu.Lock()
+	cached, ok := locales[userID]
+	localesMu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.locale
+	}
+
+	account, err := services.GetAccountId(ctx, nk, logger, userID)
+	if err != nil {
+		logger.Warn("failed to resolve the locale of %s: %v", userID, err)
+		return current().config.Default
+	}
+	locale := Normalize(account.LangTag)
+	if locale == "" {
+		locale = current().config.Default
+	}
+
+	localesMu.Lock()
+	defer localesMu.Unlock()
+	if len(locales) >= maxCachedLocales {
+		for id, l := range locales {
+			if now.After(l.expires) {
+				delete(locales, id)
+			}
+		}
+		if len(locales) >= maxCachedLocales {
+			locales = make(map[string]cachedLocale)
+		}
+	}
+	locales[userID] = cachedLocale{locale: locale, expires: now.Add(localeTTL)}
+	return locale
+}
+
+// CallerLocale is the locale of the user calling, the default locale for
+// server to server calls
+func CallerLocale(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger) string {
+	return UserLocale(ctx, nk, logger, utils.UserID(ctx))
+}
+
+// Forget drops the cached locale of userID, e.g. after its LangTag changed
+func Forget(userID string) {
+	localesMu.Lock()
+	defer localesMu.Unlock()
+	delete(locales, userID)
+}
@@ -0,0 +1,91 @@
+package i18n
+
+// ---- plural rules ----
+// the plural forms of a language, in the order gettext numbers them in
+// msgstr[n]. Rules follow CLDR for integer counts, languages without a
+// rule use the english one/other.
+
+const (
+	pluralOne   = "one"
+	pluralFew   = "few"
+	pluralMany  = "many"
+	pluralOther = "other"
+)
+
+type pluralRule struct {
+	forms []string
+	index func(n int) int
+}
+
+var (
+	oneOther = pluralRule{
+		forms: []string{pluralOne, pluralOther},
+		index: func(n int) int {
+			if n == 1 {
+				return 0
+			}
+			return 1
+		},
+	}
+	// french and portuguese count 0 as singular
+	zeroOneOther = pluralRule{
+		forms: []string{pluralOne, pluralOther},
+		index: func(n int) int {
+			if n == 0 || n == 1 {
+				return 0
+			}
+			return 1
+		},
+	}
+	otherOnly = pluralRule{
+		forms: []string{pluralOther},
+		index: func(int) int { return 0 },
+	}
+	eastSlavic = pluralRule{
+		forms: []string{pluralOne, pluralFew, pluralMany},
+		index: func(n int) int {
+			switch {
+			case n%10 == 1 && n%100 != 11:
+				return 0
+			case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+				return 1
+			}
+			return 2
+		},
+	}
+	polish = pluralRule{
+		forms: []string{pluralOne, pluralFew, pluralMany},
+		index: func(n int) int {
+			switch {
+			case n == 1:
+				return 0
+			case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+				return 1
+			}
+			return 2
+		},
+	}
+)
+
+var pluralRules = map[string]pluralRule{
+	"fr": zeroOneOther,
+	"pt": zeroOneOther,
+	"ru": eastSlavic,
+	"uk": eastSlavic,
+	"be": eastSlavic,
+	"pl": polish,
+	"ja": otherOnly,
+	"ko": otherOnly,
+	"zh": otherOnly,
+	"th": otherOnly,
+	"vi": otherOnly,
+	"id": otherOnly,
+}
+
+// pluralRuleFor returns the rule of the language of locale
+func pluralRuleFor(locale string) pluralRule {
+	if r, ok := pluralRules[language(locale)]; ok {
+		return r
+	}
+	return oneOther
+}
@@ -25,11 +25,20 @@ type Wallet struct {
 	Diamonds int64 `json:"diamonds"`
 }
 
+// UpdateProfileRequest is a partial update, fields left out keep their
+// current value. Metadata keys are merged into the current metadata, a key
+// set to "" is removed.
 type UpdateProfileRequest struct {
-	DisplayName string `json:"display_name"`
+	DisplayName *string           `json:"display_name,omitempty" validate:"max=32,pattern=^[^\\p{C}\\s]([^\\p{C}]*[^\\p{C}\\s])?$"`
+	AvatarURL   *string           `json:"avatar_url,omitempty" validate:"max=512,url"`
+	LangTag     *string           `json:"lang_tag,omitempty" validate:"max=18,pattern=^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8})*$"`
+	Timezone    *string           `json:"timezone,omitempty" validate:"max=64"`
+	Location    *string           `json:"location,omitempty" validate:"max=255"`
+	Metadata    map[string]string `json:"metadata,omitempty" validate:"max=16"`
 }
 
-type UpdateProfileResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+// Empty reports whether the request changes nothing
+func (r *UpdateProfileRequest) Empty() bool {
+	return r.DisplayName == nil && r.AvatarURL == nil && r.LangTag == nil &&
+		r.Timezone == nil && r.Location == nil && len(r.Metadata) == 0
 }
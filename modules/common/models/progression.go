@@ -0,0 +1,21 @@
+package models
+
+// Progression is the xp and level state of an account
+type Progression struct {
+	Level      int   `json:"level"`
+	Experience int64 `json:"experience"`
+	// LastLoginDay is the last day (YYYY-MM-DD, UTC) login xp was granted
+	LastLoginDay string `json:"last_login_day,omitempty"`
+	// PendingRewards are level-up rewards whose wallet update failed, they're
+	// paid with the next progression update
+	PendingRewards []LevelReward `json:"pending_rewards,omitempty"`
+	// RecentEvents are the idempotency keys of the last events that
+	// granted xp, a redelivered event finds its key and grants nothing
+	RecentEvents []string `json:"recent_events,omitempty"`
+	UpdatedAt    int64    `json:"updated_at"`
+}
+
+type LevelReward struct {
+	Level     int              `json:"level"`
+	Changeset map[string]int64 `json:"changeset"`
+}
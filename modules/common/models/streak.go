@@ -0,0 +1,17 @@
+package models
+
+// LoginStreak is the daily login streak of an account. Days are calendar
+// days in the account's timezone.
+type LoginStreak struct {
+	Streak int `json:"streak"`
+	Best   int `json:"best"`
+	// CalendarDay is the calendar day rewarded by the last counted login
+	CalendarDay int `json:"calendar_day"`
+	// LastLoginDay is the last counted day (YYYY-MM-DD) in Timezone
+	LastLoginDay string `json:"last_login_day,omitempty"`
+	Timezone     string `json:"timezone,omitempty"`
+	Freezes      int    `json:"freezes"`
+	FreezesUsed  int    `json:"freezes_used"`
+	TotalLogins  int    `json:"total_logins"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
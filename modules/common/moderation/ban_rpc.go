@@ -0,0 +1,163 @@
+package moderation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	shared "github.com/titan/titan-runtime/shared"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+	rpcTimeout       = 10 * time.Second
+)
+
+type banRequest struct {
+	TargetType string `json:"target_type" validate:"required,oneof=user device"`
+	TargetID   string `json:"target_id" validate:"required,max=128"`
+	Reason     string `json:"reason" validate:"required,max=1024"`
+	// Actor is who bans, e.g. the support agent. Duration is a go duration
+	// and ExpiresAt unix seconds, a ban without either is permanent.
+	Actor     string `json:"actor" validate:"required,max=128"`
+	Duration  string `json:"duration"`
+	ExpiresAt int64  `json:"expires_at" validate:"min=0"`
+}
+
+type unbanRequest struct {
+	TargetType string `json:"target_type" validate:"required,oneof=user device"`
+	TargetID   string `json:"target_id" validate:"required,max=128"`
+	// BanID only revokes that ban, all active bans of the target otherwise
+	BanID  string `json:"ban_id" validate:"max=64"`
+	Reason string `json:"reason" validate:"required,max=1024"`
+	Actor  string `json:"actor" validate:"required,max=128"`
+}
+
+type unbanResponse struct {
+	Revoked []string `json:"revoked"`
+}
+
+type listBansRequest struct {
+	TargetType string `json:"target_type" validate:"oneof=user device"`
+	TargetID   string `json:"target_id" validate:"max=128"`
+	ActiveOnly bool   `json:"active_only"`
+	Limit      int    `json:"limit" validate:"min=0"`
+}
+
+type listBansResponse struct {
+	Bans []*Ban `json:"bans"`
+}
+
+type listAuditRequest struct {
+	TargetType string `json:"target_type" validate:"oneof=user device"`
+	TargetID   string `json:"target_id" validate:"max=128"`
+	Limit      int    `json:"limit" validate:"min=0"`
+}
+
+type listAuditResponse struct {
+	Entries []*AuditEntry `json:"entries"`
+}
+
+func banError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidBan):
+		return runtime.NewError(err.Error(), shared.INVALID_ARGUMENT)
+	case errors.Is(err, ErrBanNotFound):
+		return runtime.NewError(err.Error(), shared.NOT_FOUND)
+	}
+	return err
+}
+
+func listLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return defaultListLimit
+	case limit > maxListLimit:
+		return maxListLimit
+	}
+	return limit
+}
+
+// BanHandler bans a user or a device. Banned users are logged out of their
+// sessions right away.
+func BanHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *banRequest) (*Ban, error) {
+	b := &Ban{
+		TargetType: req.TargetType,
+		TargetID:   req.TargetID,
+		Reason:     req.Reason,
+		BannedBy:   req.Actor,
+	}
+	switch {
+	case req.Duration != "" && req.ExpiresAt != 0:
+		return nil, banError(fmt.Errorf("%w: set either duration or expires_at", ErrInvalidBan))
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return nil, banError(fmt.Errorf("%w: invalid duration %q", ErrInvalidBan, req.Duration))
+		}
+		expiresAt := time.Now().Add(d)
+		b.ExpiresAt = &expiresAt
+	case req.ExpiresAt != 0:
+		expiresAt := time.Unix(req.ExpiresAt, 0)
+		b.ExpiresAt = &expiresAt
+	}
+
+	if b.TargetType == BanTargetUser {
+		users, err := nk.UsersGetId(ctx, []string{b.TargetID}, nil)
+		if err != nil || len(users) == 0 {
+			return nil, runtime.NewError("user not found", shared.NOT_FOUND)
+		}
+	}
+
+	if err := CreateBan(ctx, db, b); err != nil {
+		return nil, banError(err)
+	}
+	logger.WithFields(map[string]interface{}{
+		"ban_id":      b.ID,
+		"target_type": b.TargetType,
+		"target_id":   b.TargetID,
+		"actor":       b.BannedBy,
+	}).Info("ban created: %s", b.Reason)
+
+	if b.TargetType == BanTargetUser {
+		if err := nk.SessionLogout(b.TargetID, "", ""); err != nil {
+			logger.Warn("failed to log out banned user %s: %v", b.TargetID, err)
+		}
+	}
+	return b, nil
+}
+
+// UnbanHandler revokes the active bans of a user or a device
+func UnbanHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *unbanRequest) (*unbanResponse, error) {
+	revoked, err := RevokeBans(ctx, db, req.TargetType, req.TargetID, req.BanID, req.Actor, req.Reason)
+	if err != nil {
+		return nil, banError(err)
+	}
+	logger.WithFields(map[string]interface{}{
+		"bans":        revoked,
+		"target_type": req.TargetType,
+		"target_id":   req.TargetID,
+		"actor":       req.Actor,
+	}).Info("bans revoked: %s", req.Reason)
+	return &unbanResponse{Revoked: revoked}, nil
+}
+
+func ListBansHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *listBansRequest) (*listBansResponse, error) {
+	bans, err := ListBans(ctx, db, req.TargetType, req.TargetID, req.ActiveOnly, listLimit(req.Limit))
+	if err != nil {
+		return nil, err
+	}
+	return &listBansResponse{Bans: bans}, nil
+}
+
+func ListModerationAuditHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *listAuditRequest) (*listAuditResponse, error) {
+	entries, err := ListAudit(ctx, db, req.TargetType, req.TargetID, listLimit(req.Limit))
+	if err != nil {
+		return nil, err
+	}
+	return &listAuditResponse{Entries: entries}, nil
+}
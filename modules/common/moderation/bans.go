@@ -0,0 +1,336 @@
+package moderation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/titan/titan-runtime/modules/common/outbox"
+	"github.com/titan/titan-runtime/modules/utils"
+)
+
+// ---- bans ----
+// bans are kept per user id or per device id, permanent or until they
+// expire, and are never deleted: unbanning revokes them. Every ban and
+// unban is written to the audit table in the same transaction, along with
+// an account_banned or account_unbanned event in the outbox.
+
+const (
+	BanTargetUser   = "user"
+	BanTargetDevice = "device"
+
+	auditActionBan   = "ban"
+	auditActionUnban = "unban"
+)
+
+var (
+	ErrBanNotFound = errors.New("no active ban found")
+	ErrInvalidBan  = errors.New("invalid ban")
+)
+
+const createBansTableQuery = `
+CREATE TABLE IF NOT EXISTS titan_bans (
+	id            VARCHAR(64)  PRIMARY KEY,
+	target_type   VARCHAR(16)  NOT NULL,
+	target_id     VARCHAR(128) NOT NULL,
+	reason        TEXT         NOT NULL,
+	banned_by     VARCHAR(128) NOT NULL,
+	created_at    TIMESTAMPTZ  NOT NULL DEFAULT now(),
+	expires_at    TIMESTAMPTZ,
+	revoked_at    TIMESTAMPTZ,
+	revoked_by    VARCHAR(128) NOT NULL DEFAULT '',
+	revoke_reason TEXT         NOT NULL DEFAULT ''
+)`
+
+const createBansTargetIndexQuery = `
+CREATE INDEX IF NOT EXISTS titan_bans_target_idx
+	ON titan_bans (target_type, target_id) WHERE revoked_at IS NULL`
+
+const createAuditTableQuery = `
+CREATE TABLE IF NOT EXISTS titan_moderation_audit (
+	id          VARCHAR(64)  PRIMARY KEY,
+	action      VARCHAR(16)  NOT NULL,
+	ban_id      VARCHAR(64)  NOT NULL,
+	target_type VARCHAR(16)  NOT NULL,
+	target_id   VARCHAR(128) NOT NULL,
+	actor       VARCHAR(128) NOT NULL,
+	reason      TEXT         NOT NULL,
+	expires_at  TIMESTAMPTZ,
+	created_at  TIMESTAMPTZ  NOT NULL DEFAULT now()
+)`
+
+const createAuditTargetIndexQuery = `
+CREATE INDEX IF NOT EXISTS titan_moderation_audit_target_idx
+	ON titan_moderation_audit (target_type, target_id, created_at)`
+
+const insertBanQuery = `
+INSERT INTO titan_bans (id, target_type, target_id, reason, banned_by, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING created_at`
+
+const revokeBansQuery = `
+UPDATE titan_bans SET revoked_at = now(), revoked_by = $3, revoke_reason = $4
+WHERE revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+	AND target_type = $1 AND target_id = $2 AND ($5 = '' OR id = $5)
+RETURNING id, expires_at`
+
+const insertAuditQuery = `
+INSERT INTO titan_moderation_audit (id, action, ban_id, target_type, target_id, actor, reason, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+const banColumns = `id, target_type, target_id, reason, banned_by, created_at, expires_at, revoked_at, revoked_by, revoke_reason`
+
+// a permanent ban outlasts any timed one
+const activeBanQuery = `
+SELECT ` + banColumns + ` FROM titan_bans
+WHERE target_type = $1 AND target_id = $2
+	AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+ORDER BY expires_at DESC NULLS FIRST
+LIMIT 1`
+
+const listBansQuery = `
+SELECT ` + banColumns + ` FROM titan_bans
+WHERE ($1 = '' OR target_type = $1) AND ($2 = '' OR target_id = $2)
+	AND (NOT $3 OR (revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())))
+ORDER BY created_at DESC
+LIMIT $4`
+
+const listAuditQuery = `
+SELECT id, action, ban_id, target_type, target_id, actor, reason, expires_at, created_at
+FROM titan_moderation_audit
+WHERE ($1 = '' OR target_type = $1) AND ($2 = '' OR target_id = $2)
+ORDER BY created_at DESC
+LIMIT $3`
+
+// nakama's own table of the devices linked to accounts
+const deviceOwnerQuery = `
+SELECT user_id FROM user_device WHERE id = $1`
+
+type Ban struct {
+	ID         string `json:"id"`
+	TargetType string `json:"target_type"`
+	TargetID   string `json:"target_id"`
+	Reason     string `json:"reason"`
+	BannedBy   string `json:"banned_by"`
+	// ExpiresAt is nil for permanent bans
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy    string     `json:"revoked_by,omitempty"`
+	RevokeReason string     `json:"revoke_reason,omitempty"`
+}
+
+// Active reports whether the ban is in force at now
+func (b *Ban) Active(now time.Time) bool {
+	return b.RevokedAt == nil && (b.ExpiresAt == nil || b.ExpiresAt.After(now))
+}
+
+type AuditEntry struct {
+	ID         string     `json:"id"`
+	Action     string     `json:"action"`
+	BanID      string     `json:"ban_id"`
+	TargetType string     `json:"target_type"`
+	TargetID   string     `json:"target_id"`
+	Actor      string     `json:"actor"`
+	Reason     string     `json:"reason"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func createBansTables(ctx context.Context, db *sql.DB) error {
+	for _, q := range []string{createBansTableQuery, createBansTargetIndexQuery, createAuditTableQuery, createAuditTargetIndexQuery} {
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateBan stores b, with its audit entry and an account_banned event
+func CreateBan(ctx context.Context, db *sql.DB, b *Ban) error {
+	if b.TargetType != BanTargetUser && b.TargetType != BanTargetDevice {
+		return fmt.Errorf("%w: unknown target type %q", ErrInvalidBan, b.TargetType)
+	}
+	if b.TargetID == "" || b.Reason == "" || b.BannedBy == "" {
+		return fmt.Errorf("%w: target, reason and actor are required", ErrInvalidBan)
+	}
+	if b.ExpiresAt != nil && !b.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expires_at is in the past", ErrInvalidBan)
+	}
+
+	b.ID = utils.NewID()
+	return outbox.WithTx(ctx, db, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, insertBanQuery, b.ID, b.TargetType, b.TargetID, b.Reason, b.BannedBy, b.ExpiresAt).Scan(&b.CreatedAt); err != nil {
+			return fmt.Errorf("failed to insert ban: %w", err)
+		}
+		if err := writeAudit(ctx, tx, auditActionBan, b.ID, b.TargetType, b.TargetID, b.BannedBy, b.Reason, b.ExpiresAt); err != nil {
+			return err
+		}
+		return outbox.Enqueue(ctx, tx, "account_banned", banEventProps(b.ID, b.TargetType, b.TargetID, b.Reason, b.ExpiresAt))
+	})
+}
+
+// RevokeBans revokes the active bans of a target, or only banID when set,
+// and returns the ids revoked. ErrBanNotFound is returned when nothing was
+// active.
+func RevokeBans(ctx context.Context, db *sql.DB, targetType, targetID, banID, actor, reason string) ([]string, error) {
+	var revoked []string
+	err := outbox.WithTx(ctx, db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, revokeBansQuery, targetType, targetID, actor, reason, banID)
+		if err != nil {
+			return fmt.Errorf("failed to revoke bans: %w", err)
+		}
+		type revokedBan struct {
+			id        string
+			expiresAt *time.Time
+		}
+		var bans []revokedBan
+		for rows.Next() {
+			var b revokedBan
+			var expiresAt sql.NullTime
+			if err := rows.Scan(&b.id, &expiresAt); err != nil {
+				rows.Close()
+				return err
+			}
+			if expiresAt.Valid {
+				b.expiresAt = &expiresAt.Time
+			}
+			bans = append(bans, b)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(bans) == 0 {
+			return ErrBanNotFound
+		}
+
+		for _, b := range bans {
+			if err := writeAudit(ctx, tx, auditActionUnban, b.id, targetType, targetID, actor, reason, b.expiresAt); err != nil {
+				return err
+			}
+			if err := outbox.Enqueue(ctx, tx, "account_unbanned", banEventProps(b.id, targetType, targetID, reason, nil)); err != nil {
+				return err
+			}
+			revoked = append(revoked, b.id)
+		}
+		return nil
+	})
+	return revoked, err
+}
+
+// ActiveBan returns the ban in force on a target, nil when there's none
+func ActiveBan(ctx context.Context, db *sql.DB, targetType, targetID string) (*Ban, error) {
+	b, err := scanBan(db.QueryRowContext(ctx, activeBanQuery, targetType, targetID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// ListBans lists the bans of a target type and id, an empty filter
+// matches all
+func ListBans(ctx context.Context, db *sql.DB, targetType, targetID string, activeOnly bool, limit int) ([]*Ban, error) {
+	rows, err := db.QueryContext(ctx, listBansQuery, targetType, targetID, activeOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bans []*Ban
+	for rows.Next() {
+		b, err := scanBan(rows)
+		if err != nil {
+			return nil, err
+		}
+		bans = append(bans, b)
+	}
+	return bans, rows.Err()
+}
+
+// ListAudit lists the audit trail of a target, newest first
+func ListAudit(ctx context.Context, db *sql.DB, targetType, targetID string, limit int) ([]*AuditEntry, error) {
+	rows, err := db.QueryContext(ctx, listAuditQuery, targetType, targetID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&e.ID, &e.Action, &e.BanID, &e.TargetType, &e.TargetID, &e.Actor, &e.Reason, &expiresAt, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			e.ExpiresAt = &expiresAt.Time
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+// DeviceBan returns the ban in force on a device, or on the account it's
+// linked to
+func DeviceBan(ctx context.Context, db *sql.DB, deviceID string) (*Ban, error) {
+	b, err := ActiveBan(ctx, db, BanTargetDevice, deviceID)
+	if err != nil || b != nil {
+		return b, err
+	}
+
+	var userID string
+	err = db.QueryRowContext(ctx, deviceOwnerQuery, deviceID).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// a new device, its account doesn't exist yet
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ActiveBan(ctx, db, BanTargetUser, userID)
+}
+
+func writeAudit(ctx context.Context, tx *sql.Tx, action, banID, targetType, targetID, actor, reason string, expiresAt *time.Time) error {
+	if _, err := tx.ExecContext(ctx, insertAuditQuery, utils.NewID(), action, banID, targetType, targetID, actor, reason, expiresAt); err != nil {
+		return fmt.Errorf("failed to write moderation audit: %w", err)
+	}
+	return nil
+}
+
+func banEventProps(banID, targetType, targetID, reason string, expiresAt *time.Time) map[string]string {
+	props := map[string]string{
+		"ban_id":      banID,
+		"target_type": targetType,
+		"target_id":   targetID,
+		"reason":      reason,
+	}
+	if targetType == BanTargetUser {
+		props["user_id"] = targetID
+	}
+	if expiresAt != nil {
+		props["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
+	return props
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBan(row scanner) (*Ban, error) {
+	var b Ban
+	var expiresAt, revokedAt sql.NullTime
+	if err := row.Scan(&b.ID, &b.TargetType, &b.TargetID, &b.Reason, &b.BannedBy, &b.CreatedAt, &expiresAt, &revokedAt, &b.RevokedBy, &b.RevokeReason); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		b.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		b.RevokedAt = &revokedAt.Time
+	}
+	return &b, nil
+}
@@ -0,0 +1,53 @@
+package moderation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/utils"
+	shared "github.com/titan/titan-runtime/shared"
+)
+
+// BeforeUpdateAccount moderates names changed through nakama's own account
+// update api. The display name claimed here is confirmed by the account
+// domain's AfterUpdateAccount, nakama takes a single after hook per api.
+func BeforeUpdateAccount(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *api.UpdateAccountRequest) (*api.UpdateAccountRequest, error) {
+	if username := in.GetUsername().GetValue(); username != "" {
+		if err := CheckName(username); err != nil {
+			logger.Info("rejected username %q: %v", username, err)
+			return nil, FieldError("username", err)
+		}
+	}
+	if displayName := in.GetDisplayName().GetValue(); displayName != "" {
+		if err := ValidateDisplayName(ctx, db, utils.UserID(ctx), displayName); err != nil {
+			logger.Info("rejected display name %q: %v", displayName, err)
+			return nil, FieldError("display_name", err)
+		}
+	}
+	return in, nil
+}
+
+// CheckDeviceAuth rejects authentication with a banned device, or a device
+// linked to a banned account, with PERMISSION_DENIED. Nakama takes a single
+// before hook per api, so the account domain calls it from its own.
+func CheckDeviceAuth(ctx context.Context, logger runtime.Logger, db *sql.DB, deviceID string) error {
+	b, err := DeviceBan(ctx, db, deviceID)
+	if err != nil {
+		logger.Error("failed to check bans of device %s: %v", deviceID, err)
+		return shared.ErrInternalError
+	}
+	if b == nil {
+		return nil
+	}
+
+	logger.Info("rejected authentication of device %s, %s %s is banned (ban %s)", deviceID, b.TargetType, b.TargetID, b.ID)
+	message := "account is banned: " + b.Reason
+	if b.ExpiresAt != nil {
+		message = fmt.Sprintf("account is banned until %s: %s", b.ExpiresAt.UTC().Format(time.RFC3339), b.Reason)
+	}
+	return shared.NewStructuredError(message, shared.PERMISSION_DENIED, nil)
+}
@@ -0,0 +1,238 @@
+package moderation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/config"
+	"github.com/titan/titan-runtime/modules/common/rpc"
+	"github.com/titan/titan-runtime/modules/common/validation"
+	shared "github.com/titan/titan-runtime/shared"
+)
+
+// ---- name moderation ----
+// display names (and usernames) are checked against a configurable word
+// list, reserved and staff-like names and look-alike characters before
+// they're stored. Display names can also be made unique, case and
+// look-alike insensitive, see names.go.
+
+const (
+	configPathEnv     = "MODERATION_CONFIG_PATH"
+	defaultConfigPath = "modules/common/moderation/moderation.json"
+
+	// words up to this length only match whole words, longer ones also
+	// match inside other words
+	shortWordLen = 3
+)
+
+var (
+	ErrProfanity     = errors.New("contains a banned word")
+	ErrReserved      = errors.New("is reserved")
+	ErrImpersonation = errors.New("looks like a staff name")
+	ErrConfusable    = errors.New("mixes look-alike characters of different scripts")
+	ErrNameTaken     = errors.New("is already taken")
+)
+
+// the rule a violation is reported with in field errors
+var violationRules = map[error]string{
+	ErrProfanity:     "profanity",
+	ErrReserved:      "reserved",
+	ErrImpersonation: "impersonation",
+	ErrConfusable:    "confusable",
+	ErrNameTaken:     "unique",
+}
+
+type Config struct {
+	// BannedWords are rejected anywhere in a name
+	BannedWords []string `json:"banned_words"`
+	// AllowedWords contain a banned word but are fine, e.g. "scunthorpe"
+	AllowedWords []string `json:"allowed_words"`
+	// ReservedNames can't be used as a whole name
+	ReservedNames []string `json:"reserved_names"`
+	// ImpersonationTerms are rejected anywhere in a name, e.g. "admin"
+	ImpersonationTerms []string `json:"impersonation_terms"`
+	// UniqueDisplayNames makes display names unique across accounts
+	UniqueDisplayNames bool `json:"unique_display_names"`
+}
+
+// normalized word lists, folded like the names they're matched against
+type rules struct {
+	banned, allowed, reserved, impersonation []string
+	unique                                   bool
+}
+
+var (
+	rulesMu sync.RWMutex
+	active  = &rules{}
+)
+
+func currentRules() *rules {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	return active
+}
+
+// SetConfig replaces the active moderation config
+func SetConfig(cfg *Config) {
+	normalize := func(list []string) []string {
+		out := make([]string, 0, len(list))
+		for _, w := range list {
+			if _, compact := words(w); compact != "" {
+				out = append(out, compact)
+			}
+		}
+		return out
+	}
+	r := &rules{
+		banned:        normalize(cfg.BannedWords),
+		allowed:       normalize(cfg.AllowedWords),
+		reserved:      normalize(cfg.ReservedNames),
+		impersonation: normalize(cfg.ImpersonationTerms),
+		unique:        cfg.UniqueDisplayNames,
+	}
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	active = r
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid moderation config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	logger.Info("Initializing Moderation domain...")
+	path := config.Env(ctx, configPathEnv, defaultConfigPath)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	SetConfig(cfg)
+
+	if err := createNamesTable(ctx, db); err != nil {
+		return err
+	}
+	if cfg.UniqueDisplayNames {
+		if err := backfillDisplayNames(ctx, logger, db); err != nil {
+			return err
+		}
+	}
+	if err := createBansTables(ctx, db); err != nil {
+		return err
+	}
+	if err := initializer.RegisterBeforeUpdateAccount(BeforeUpdateAccount); err != nil {
+		return err
+	}
+
+	router := rpc.NewRouter(initializer).Use(rpc.ServerOnly, rpc.Timeout(rpcTimeout))
+	if err := rpc.Register(router, "ban_account", BanHandler); err != nil {
+		return err
+	}
+	if err := rpc.Register(router, "unban_account", UnbanHandler); err != nil {
+		return err
+	}
+	if err := rpc.Register(router, "list_bans", ListBansHandler); err != nil {
+		return err
+	}
+	if err := rpc.Register(router, "list_moderation_audit", ListModerationAuditHandler); err != nil {
+		return err
+	}
+
+	logger.Info("Moderation domain initialized with %d banned words, unique display names: %t", len(cfg.BannedWords), cfg.UniqueDisplayNames)
+	return nil
+}
+
+// CheckName checks the content of a name, it returns one of the violation
+// errors or nil
+func CheckName(name string) error {
+	r := currentRules()
+	if mixesScripts(name) {
+		return ErrConfusable
+	}
+
+	tokens, compact := words(name)
+	for _, w := range r.reserved {
+		if compact == w || squeeze(compact) == squeeze(w) {
+			return ErrReserved
+		}
+	}
+	if matchesAny(tokens, compact, r.impersonation, nil) {
+		return ErrImpersonation
+	}
+	if matchesAny(tokens, compact, r.banned, r.allowed) {
+		return ErrProfanity
+	}
+	return nil
+}
+
+// matchesAny reports whether one of list is in the name. Short words must
+// be a whole token, longer ones may be part of the compact name once the
+// allowed words are cut out. Repeated letters are squeezed on both sides.
+func matchesAny(tokens []string, compact string, list, allowed []string) bool {
+	for _, a := range allowed {
+		compact = strings.ReplaceAll(compact, a, " ")
+	}
+	squeezed := squeeze(compact)
+	for _, w := range list {
+		if len(w) <= shortWordLen {
+			for _, t := range tokens {
+				if t == w || squeeze(t) == squeeze(w) {
+					return true
+				}
+			}
+			continue
+		}
+		if strings.Contains(compact, w) || strings.Contains(squeezed, squeeze(w)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateDisplayName checks the display name of userID and, when display
+// names are unique, claims it for the user. The caller confirms the claim
+// with ConfirmDisplayName once the account is updated, or releases it with
+// ReleaseDisplayName when the update fails.
+func ValidateDisplayName(ctx context.Context, db *sql.DB, userID, name string) error {
+	if err := CheckName(name); err != nil {
+		return err
+	}
+	if !currentRules().unique {
+		return nil
+	}
+	return claimDisplayName(ctx, db, userID, name)
+}
+
+// FieldError converts a moderation error of field to the runtime error the
+// client gets, a taken name is ALREADY_EXISTS and any other violation
+// INVALID_ARGUMENT
+func FieldError(field string, err error) error {
+	if err == nil {
+		return nil
+	}
+	for violation, rule := range violationRules {
+		if !errors.Is(err, violation) {
+			continue
+		}
+		fields := []shared.FieldError{{Field: field, Rule: rule, Message: violation.Error()}}
+		if violation == ErrNameTaken {
+			return shared.NewStructuredError("name is taken", shared.ALREADY_EXISTS, fields)
+		}
+		return validation.ToRuntimeError(validation.Errors(fields))
+	}
+	return shared.ErrInternalError
+}
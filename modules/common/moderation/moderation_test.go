@@ -0,0 +1,73 @@
+package moderation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "case", in: "BoB", want: "bob"},
+		{name: "accents", in: "Zoë Ñúñez", want: "zoe nunez"},
+		{name: "fullwidth", in: "Ｂｏｂ", want: "bob"},
+		{name: "cyrillic look-alikes", in: "\u0410l\u0456c\u0435", want: "alice"},
+		{name: "greek look-alikes", in: "\u039a\u03bfala", want: "koala"},
+		{name: "combining marks", in: "Bo\u0301b", want: "bob"},
+		{name: "invisible characters", in: "B\u200bob", want: "bob"},
+		{name: "spaces collapsed", in: "  big   bob ", want: "big bob"},
+		{name: "leetspeak kept", in: "B0b", want: "b0b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Canonical(tt.in); got != tt.want {
+				t.Fatalf("Canonical(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	SetConfig(&Config{
+		BannedWords:        []string{"ass", "darn"},
+		AllowedWords:       []string{"classic"},
+		ReservedNames:      []string{"system"},
+		ImpersonationTerms: []string{"admin", "moderator"},
+	})
+	t.Cleanup(func() { SetConfig(&Config{}) })
+
+	tests := []struct {
+		name string
+		in   string
+		want error
+	}{
+		{name: "clean", in: "Bob"},
+		{name: "clean with digits", in: "Player 42"},
+		{name: "banned word", in: "darn it", want: ErrProfanity},
+		{name: "banned word inside a longer word", in: "bigdarnbob", want: ErrProfanity},
+		{name: "banned word with separators", in: "d.a.r.n", want: ErrProfanity},
+		{name: "banned word in leetspeak", in: "d4rn", want: ErrProfanity},
+		{name: "banned word with repeated letters", in: "daaarn", want: ErrProfanity},
+		{name: "short word as a whole token", in: "big ass", want: ErrProfanity},
+		{name: "short word inside a word", in: "passport"},
+		{name: "allowed word", in: "classic"},
+		{name: "reserved", in: "System", want: ErrReserved},
+		{name: "reserved with repeated letters", in: "ssystem", want: ErrReserved},
+		{name: "reserved as part of a name", in: "system fan"},
+		{name: "impersonation", in: "the_admin", want: ErrImpersonation},
+		{name: "impersonation with mixed scripts", in: "\u041coderator", want: ErrConfusable},
+		{name: "impersonation with accents", in: "ádmin", want: ErrImpersonation},
+		{name: "mixed scripts", in: "B\u043eb", want: ErrConfusable},
+		{name: "single other script", in: "Борис"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckName(tt.in); !errors.Is(got, tt.want) {
+				t.Fatalf("CheckName(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package moderation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/common/outbox"
+)
+
+// ---- unique display names ----
+// every account's display name is kept with its canonical form in a table
+// of our own, the unique index on the canonical form makes "Bob", "BOB"
+// and "Вob" (cyrillic В) the same name.
+//
+// A name is claimed before the account update and confirmed after it: the
+// claim adds an unconfirmed row next to the user's current name, confirming
+// drops the user's other names. An update that fails releases the claim,
+// and a claim that was never confirmed (nakama's own update failing after
+// the before hook) can be taken over by another user after
+// staleClaimTimeout.
+
+const staleClaimTimeout = "10 minutes"
+
+const createNamesTableQuery = `
+CREATE TABLE IF NOT EXISTS titan_display_names (
+	user_id      UUID         NOT NULL,
+	display_name VARCHAR(255) NOT NULL,
+	canonical    VARCHAR(255) NOT NULL,
+	confirmed    BOOLEAN      NOT NULL DEFAULT false,
+	updated_at   TIMESTAMPTZ  NOT NULL DEFAULT now()
+)`
+
+const createNamesIndexQuery = `
+CREATE UNIQUE INDEX IF NOT EXISTS titan_display_names_canonical_idx
+	ON titan_display_names (canonical)`
+
+const createNamesUserIndexQuery = `
+CREATE INDEX IF NOT EXISTS titan_display_names_user_idx
+	ON titan_display_names (user_id)`
+
+// the update only happens when the name is the user's or a stale claim,
+// no row affected means it's taken
+const claimNameQuery = `
+INSERT INTO titan_display_names (user_id, display_name, canonical)
+VALUES ($1, $2, $3)
+ON CONFLICT (canonical) DO UPDATE
+SET user_id = EXCLUDED.user_id, display_name = EXCLUDED.display_name, updated_at = now(),
+	confirmed = titan_display_names.confirmed AND titan_display_names.user_id = EXCLUDED.user_id
+WHERE titan_display_names.user_id = EXCLUDED.user_id
+	OR (NOT titan_display_names.confirmed AND titan_display_names.updated_at < now() - $4::interval)`
+
+const releaseNameQuery = `
+DELETE FROM titan_display_names WHERE user_id = $1 AND canonical = $2 AND NOT confirmed`
+
+const dropOtherNamesQuery = `
+DELETE FROM titan_display_names WHERE user_id = $1 AND canonical <> $2`
+
+const confirmNameQuery = `
+UPDATE titan_display_names SET confirmed = true, updated_at = now()
+WHERE user_id = $1 AND canonical = $2`
+
+// accounts named before the table existed, or while names weren't unique
+const unclaimedNamesQuery = `
+SELECT u.id, u.display_name FROM users u
+WHERE u.display_name IS NOT NULL AND u.display_name <> ''
+	AND NOT EXISTS (SELECT 1 FROM titan_display_names n WHERE n.user_id = u.id)`
+
+const backfillNameQuery = `
+INSERT INTO titan_display_names (user_id, display_name, canonical, confirmed)
+VALUES ($1, $2, $3, true)
+ON CONFLICT (canonical) DO NOTHING`
+
+func createNamesTable(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, createNamesTableQuery); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, createNamesIndexQuery); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, createNamesUserIndexQuery)
+	return err
+}
+
+// backfillDisplayNames claims the names of existing accounts. Accounts that
+// already share a canonical name can't both have it, the first one keeps it
+// and the others are logged, they get a name of their own on their next
+// update.
+func backfillDisplayNames(ctx context.Context, logger runtime.Logger, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, unclaimedNamesQuery)
+	if err != nil {
+		return err
+	}
+	type account struct{ userID, name string }
+	var accounts []account
+	for rows.Next() {
+		var a account
+		if err := rows.Scan(&a.userID, &a.name); err != nil {
+			rows.Close()
+			return err
+		}
+		accounts = append(accounts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	claimed := 0
+	for _, a := range accounts {
+		res, err := db.ExecContext(ctx, backfillNameQuery, a.userID, a.name, Canonical(a.name))
+		if err != nil {
+			return fmt.Errorf("failed to claim display name of %s: %w", a.userID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			logger.Warn("display name %q of %s is already taken by another account", a.name, a.userID)
+			continue
+		}
+		claimed++
+	}
+	if len(accounts) > 0 {
+		logger.Info("claimed %d of %d existing display names", claimed, len(accounts))
+	}
+	return nil
+}
+
+func claimDisplayName(ctx context.Context, db *sql.DB, userID, name string) error {
+	res, err := db.ExecContext(ctx, claimNameQuery, userID, name, Canonical(name), staleClaimTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to claim display name: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNameTaken
+	}
+	return nil
+}
+
+// ConfirmDisplayName settles the claim of name once the account update
+// went through, the other names of the user are released
+func ConfirmDisplayName(ctx context.Context, db *sql.DB, userID, name string) error {
+	if !currentRules().unique {
+		return nil
+	}
+	canonical := Canonical(name)
+	return outbox.WithTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, dropOtherNamesQuery, userID, canonical); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, confirmNameQuery, userID, canonical)
+		return err
+	})
+}
+
+// ReleaseDisplayName drops the claim of name after the account update
+// failed, a name the user already had is kept
+func ReleaseDisplayName(ctx context.Context, db *sql.DB, userID, name string) error {
+	if !currentRules().unique {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, releaseNameQuery, userID, Canonical(name))
+	return err
+}
@@ -0,0 +1,126 @@
+package moderation
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ---- name normalization ----
+// names are folded before any check so look-alike spellings can't slip
+// through: case, accents, fullwidth forms and characters that look like
+// latin letters (cyrillic "а", greek "ο", ...) fold to plain latin, and
+// invisible characters are dropped. Leetspeak is undone for word matching
+// only, "B0b" and "Bob" are different names.
+
+var confusables = map[rune]rune{
+	// cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ї': 'i', 'ј': 'j',
+	'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'һ': 'h', 'ӏ': 'l', 'ո': 'n', 'ս': 'u',
+	// greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y', 'ω': 'w', 'ϲ': 'c', 'ϳ': 'j',
+	// latin variants
+	'ı': 'i', 'ł': 'l', 'ℓ': 'l', 'ǀ': 'l', 'ß': 's', 'ø': 'o', 'đ': 'd', 'ħ': 'h',
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a', 'ă': 'a', 'ą': 'a',
+	'ç': 'c', 'ć': 'c', 'č': 'c', 'ď': 'd',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e', 'ė': 'e', 'ę': 'e', 'ě': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ī': 'i', 'į': 'i',
+	'ñ': 'n', 'ń': 'n', 'ň': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ō': 'o', 'ő': 'o',
+	'ř': 'r', 'ś': 's', 'š': 's', 'ş': 's', 'ť': 't', 'ţ': 't',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ū': 'u', 'ů': 'u', 'ű': 'u',
+	'ý': 'y', 'ÿ': 'y', 'ź': 'z', 'ż': 'z', 'ž': 'z',
+}
+
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't', '€': 'e',
+}
+
+// fold lowercases name, maps look-alike characters to latin and drops
+// invisible and combining characters
+func fold(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || unicode.Is(unicode.Cf, r) {
+			continue
+		}
+		// fullwidth ascii
+		if r >= 0xFF01 && r <= 0xFF5E {
+			r -= 0xFEE0
+		}
+		r = unicode.ToLower(r)
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Canonical is the form display names are unique by
+func Canonical(name string) string {
+	return strings.Join(strings.Fields(fold(name)), " ")
+}
+
+// words returns the letter-only tokens of the folded name with leetspeak
+// undone, and the tokens joined so separators ("f.o.o") don't hide a word
+func words(name string) (tokens []string, compact string) {
+	var cur, all strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, r := range fold(name) {
+		if l, ok := leet[r]; ok {
+			r = l
+		}
+		if unicode.IsLetter(r) {
+			cur.WriteRune(r)
+			all.WriteRune(r)
+			continue
+		}
+		flush()
+	}
+	flush()
+	return tokens, all.String()
+}
+
+// squeeze collapses repeated letters, "fooo" becomes "fo"
+func squeeze(s string) string {
+	var b strings.Builder
+	var last rune = -1
+	for _, r := range s {
+		if r != last {
+			b.WriteRune(r)
+		}
+		last = r
+	}
+	return b.String()
+}
+
+// spoofing scripts, latin letters mixed with one of the others are
+// rejected as they're mostly used to imitate another name
+var spoofScripts = []*unicode.RangeTable{unicode.Latin, unicode.Cyrillic, unicode.Greek}
+
+func mixesScripts(name string) bool {
+	seen := -1
+	for _, r := range name {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for i, script := range spoofScripts {
+			if !unicode.Is(script, r) {
+				continue
+			}
+			if seen >= 0 && seen != i {
+				return true
+			}
+			seen = i
+		}
+	}
+	return false
+}
@@ -1,32 +1,320 @@
 package notifier
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
+	eventProcessor "github.com/titan/titan-runtime/modules/common/eventProcessor"
+	"github.com/titan/titan-runtime/modules/common/i18n"
+	"github.com/titan/titan-runtime/modules/common/rpc"
 )
 
-func SendNotifications(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, user1, user2 string, content map[string]interface{}, persistent bool, code int) error {
-	notifications := []*runtime.NotificationSend{
-		{
-			UserID:     user2,
-			Subject:    "New Friend",
-			Content:    content,
-			Code:       code,
-			Persistent: persistent,
-		},
-		{
-			UserID:     user1,
-			Subject:    "Friend Added",
+// ---- notification templates ----
+// every notification code has a template, registered by the domain that
+// sends it. The subject and body are text/templates rendered with the vars
+// of the notification, e.g. "{{.display_name}}", and the vars are sent
+// along as the content with the rendered body under "body". The audience
+// says who of the recipients gets it. Subject and body are written in
+// english and translated to the locale of each recipient before rendering.
+
+// NotificationMessage is the code of a notification, codes are unique
+// across domains
+type NotificationMessage int
+
+type Audience string
+
+const (
+	// AudienceSelf notifies the user the notification is about
+	AudienceSelf Audience = "self"
+	// AudienceOther notifies the other user, e.g. the friend added
+	AudienceOther Audience = "other"
+	AudienceBoth  Audience = "both"
+)
+
+// BodyKey is the content key of the rendered body
+const BodyKey = "body"
+
+var ErrUnknownCode = errors.New("no template registered for notification code")
+
+type Template struct {
+	Subject string
+	Body    string
+	// BodyPlural makes the body a plural message, the form is picked by
+	// the integer var named Count
+	BodyPlural string
+	Count      string
+	// Persistent is the default persistence, Notify can override it
+	Persistent bool
+	Audience   Audience
+}
+
+// Recipients are the users of a notification, Self is the user it's about
+// and Other the counterpart, when there's one
+type Recipients struct {
+	Self  string
+	Other string
+}
+
+// Vars are substituted in the templates and sent as content
+type Vars map[string]interface{}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[NotificationMessage]Template)
+
+	// parsed templates by their text, translations included
+	parsed sync.Map
+)
+
+// Register adds the template of code, codes can only be registered once
+func Register(code NotificationMessage, t Template) error {
+	switch t.Audience {
+	case AudienceSelf, AudienceOther, AudienceBoth:
+	default:
+		return fmt.Errorf("notification %d has unknown audience %q", code, t.Audience)
+	}
+	if (t.BodyPlural == "") != (t.Count == "") {
+		return fmt.Errorf("notification %d needs both a plural body and a count var", code)
+	}
+	for _, text := range []string{t.Subject, t.Body, t.BodyPlural} {
+		if _, err := parse(text); err != nil {
+			return fmt.Errorf("notification %d has an invalid template: %w", code, err)
+		}
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[code]; ok {
+		return fmt.Errorf("notification %d is already registered", code)
+	}
+	registry[code] = t
+	return nil
+}
+
+// Codes lists the registered codes in order
+func Codes() []NotificationMessage {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	codes := make([]NotificationMessage, 0, len(registry))
+	for code := range registry {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+func lookup(code NotificationMessage) (Template, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	t, ok := registry[code]
+	return t, ok
+}
+
+type Option func(*delivery)
+
+type delivery struct {
+	persistent bool
+}
+
+// Persistent overrides the persistence default of the template
+func Persistent(persistent bool) Option {
+	return func(d *delivery) {
+		d.persistent = persistent
+	}
+}
+
+// Notify renders the template of code with vars and sends it to the
+// recipients of its audience, each in their own locale. A user that is
+// both Self and Other is notified once. Recipients' preferences win over
+// the template and opts: opted out users are skipped, their channel sets
+// the persistence and notifications in their quiet hours are deferred.
+func Notify(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, code NotificationMessage, to Recipients, vars Vars, opts ...Option) error {
+	t, ok := lookup(code)
+	if !ok {
+		return fmt.Errorf("%w %d", ErrUnknownCode, code)
+	}
+	d := delivery{persistent: t.Persistent}
+	for _, opt := range opts {
+		opt(&d)
+	}
+
+	type recipient struct{ userID, senderID string }
+	var recipients []recipient
+	add := func(userID, senderID string) {
+		for _, r := range recipients {
+			if r.userID == userID {
+				return
+			}
+		}
+		recipients = append(recipients, recipient{userID, senderID})
+	}
+	if to.Self != "" && (t.Audience == AudienceSelf || t.Audience == AudienceBoth) {
+		add(to.Self, "")
+	}
+	if to.Other != "" && (t.Audience == AudienceOther || t.Audience == AudienceBoth) {
+		add(to.Other, to.Self)
+	}
+	if len(recipients) == 0 {
+		logger.Warn("notification %d has no recipient for audience %s", code, t.Audience)
+		return nil
+	}
+
+	notifications := make([]*runtime.NotificationSend, 0, len(recipients))
+	for _, r := range recipients {
+		prefs, err := GetPreferences(ctx, nk, r.userID)
+		if err != nil {
+			logger.Warn("delivering notification %d to %s without preferences: %v", code, r.userID, err)
+			prefs = &Preferences{}
+		}
+		pref := prefs.Codes[code]
+		if pref.Disabled {
+			continue
+		}
+		persistent := d.persistent
+		if pref.Channel != ChannelDefault {
+			persistent = pref.Channel == ChannelInbox
+		}
+
+		locale := i18n.UserLocale(ctx, nk, logger, r.userID)
+		subject, body, err := t.render(locale, vars)
+		if err != nil {
+			return fmt.Errorf("failed to render notification %d: %w", code, err)
+		}
+		content := make(map[string]interface{}, len(vars)+1)
+		for k, v := range vars {
+			content[k] = v
+		}
+		content[BodyKey] = body
+		n := &runtime.NotificationSend{
+			UserID:     r.userID,
+			Subject:    subject,
 			Content:    content,
-			Code:       code,
+			Code:       int(code),
+			Sender:     r.senderID,
 			Persistent: persistent,
-		},
+		}
+
+		if prefs.QuietHours != nil {
+			now := time.Now().In(userLocation(ctx, nk, logger, r.userID))
+			if due := prefs.QuietHours.until(now); !due.IsZero() {
+				if err := deferNotification(ctx, n, due); err != nil {
+					logger.Warn("failed to defer notification %d to %s, sending it now: %v", code, r.userID, err)
+				} else {
+					continue
+				}
+			}
+		}
+		notifications = append(notifications, n)
+	}
+	if len(notifications) == 0 {
+		return nil
 	}
 
 	if err := nk.NotificationsSend(ctx, notifications); err != nil {
-		logger.Warn("Failed to send friend notifications: %v", err)
+		logger.Warn("Failed to send notification %d: %v", code, err)
 		return err
 	}
 	return nil
 }
+
+// render renders the subject and body translated to locale, a translation
+// that fails to render falls back to the english text
+func (t Template) render(locale string, vars Vars) (string, string, error) {
+	bodyText := i18n.T(locale, t.Body)
+	body := t.Body
+	if t.Count != "" {
+		n := count(vars[t.Count])
+		bodyText = i18n.N(locale, t.Body, t.BodyPlural, n)
+		if n != 1 {
+			body = t.BodyPlural
+		}
+	}
+
+	renderedSubject, err := renderText(i18n.T(locale, t.Subject), t.Subject, vars)
+	if err != nil {
+		return "", "", err
+	}
+	renderedBody, err := renderText(bodyText, body, vars)
+	if err != nil {
+		return "", "", err
+	}
+	return renderedSubject, renderedBody, nil
+}
+
+func renderText(text, source string, vars Vars) (string, error) {
+	out, err := render(text, vars)
+	if err != nil && text != source {
+		return render(source, vars)
+	}
+	return out, err
+}
+
+func render(text string, vars Vars) (string, error) {
+	tmpl, err := parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]interface{}(vars)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func parse(text string) (*template.Template, error) {
+	if t, ok := parsed.Load(text); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	parsed.Store(text, t)
+	return t, nil
+}
+
+// count is the plural count of a var, 0 when it isn't a number
+func count(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return 0
+}
+
+func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	logger.Info("Initializing Notifier...")
+	setScheduleDB(db)
+
+	router := rpc.NewRouter(initializer)
+	if err := rpc.Register(router, "get_notification_preferences", GetPreferencesHandler, rpc.RequireAuth, rpc.Timeout(rpcTimeout)); err != nil {
+		return err
+	}
+	if err := rpc.Register(router, "update_notification_preferences", UpdatePreferencesHandler, rpc.RequireAuth, rpc.Timeout(rpcTimeout)); err != nil {
+		return err
+	}
+	if err := eventProcessor.Subscribe(deferredEvent, "notifier", HandleDeferredNotification); err != nil {
+		return err
+	}
+
+	logger.Info("Notifier initialized")
+	return nil
+}
@@ -0,0 +1,231 @@
+package notifier
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/common/scheduler"
+	"github.com/titan/titan-runtime/modules/common/services"
+)
+
+// ---- notification preferences ----
+// users opt out of notification codes, pick their channel, the socket for
+// in-app notifications only or the inbox for persistent ones, and set
+// quiet hours in their account timezone. A notification due in quiet hours
+// is rendered right away and scheduled for delivery when they end, through
+// the deliver_notification event.
+
+const (
+	preferencesCollection = "notification_preferences"
+	preferencesKey        = "settings"
+
+	deferredEvent = "deliver_notification"
+)
+
+type Channel string
+
+const (
+	// ChannelDefault keeps the persistence of the template
+	ChannelDefault Channel = ""
+	// ChannelSocket only delivers to connected clients
+	ChannelSocket Channel = "socket"
+	// ChannelInbox also keeps the notification in the user's inbox
+	ChannelInbox Channel = "inbox"
+)
+
+type Preferences struct {
+	// Codes are the preferences per notification code, codes without one
+	// are delivered as their template says
+	Codes      map[NotificationMessage]CodePreference `json:"codes,omitempty"`
+	QuietHours *QuietHours                            `json:"quiet_hours,omitempty"`
+	UpdatedAt  int64                                  `json:"updated_at"`
+}
+
+type CodePreference struct {
+	Disabled bool    `json:"disabled,omitempty"`
+	Channel  Channel `json:"channel,omitempty"`
+}
+
+// QuietHours run from Start to End (HH:MM) in the account timezone, and
+// past midnight when End is before Start
+type QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// until returns when the quiet hours around now end, zero when now isn't
+// in them
+func (q *QuietHours) until(now time.Time) time.Time {
+	if q == nil {
+		return time.Time{}
+	}
+	start, errStart := parseClock(q.Start)
+	end, errEnd := parseClock(q.End)
+	if errStart != nil || errEnd != nil || start == end {
+		return time.Time{}
+	}
+	minute := now.Hour()*60 + now.Minute()
+	quiet := start <= minute && minute < end
+	if end < start {
+		quiet = minute >= start || minute < end
+	}
+	if !quiet {
+		return time.Time{}
+	}
+	due := time.Date(now.Year(), now.Month(), now.Day(), end/60, end%60, 0, 0, now.Location())
+	if !due.After(now) {
+		due = time.Date(now.Year(), now.Month(), now.Day()+1, end/60, end%60, 0, 0, now.Location())
+	}
+	return due
+}
+
+// parseClock returns the minutes since midnight of HH:MM
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// GetPreferences reads the notification preferences of userID, users
+// without any get the defaults
+func GetPreferences(ctx context.Context, nk runtime.NakamaModule, userID string) (*Preferences, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: preferencesCollection,
+		Key:        preferencesKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification preferences of %s: %w", userID, err)
+	}
+	p := &Preferences{}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].GetValue()), p); err != nil {
+			return nil, fmt.Errorf("invalid notification preferences of %s: %w", userID, err)
+		}
+	}
+	if p.Codes == nil {
+		p.Codes = make(map[NotificationMessage]CodePreference)
+	}
+	return p, nil
+}
+
+// SavePreferences stores the preferences of userID, they're only changed
+// through the preferences rpc
+func SavePreferences(ctx context.Context, nk runtime.NakamaModule, userID string, p *Preferences) error {
+	p.UpdatedAt = time.Now().Unix()
+	value, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      preferencesCollection,
+		Key:             preferencesKey,
+		UserID:          userID,
+		Value:           string(value),
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}}); err != nil {
+		return fmt.Errorf("failed to write notification preferences of %s: %w", userID, err)
+	}
+	return nil
+}
+
+// userLocation is the timezone of the account, UTC when it's unset or
+// unknown
+func userLocation(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, userID string) *time.Location {
+	account, err := services.GetAccountId(ctx, nk, logger, userID)
+	if err != nil {
+		logger.Warn("failed to read the timezone of %s, using UTC: %v", userID, err)
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(account.Timezone)
+	if err != nil || account.Timezone == "" {
+		return time.UTC
+	}
+	return loc
+}
+
+// the database the deferred notifications are scheduled with, set by
+// InitModule
+var (
+	scheduleDBMu sync.RWMutex
+	scheduleDB   *sql.DB
+)
+
+func setScheduleDB(db *sql.DB) {
+	scheduleDBMu.Lock()
+	defer scheduleDBMu.Unlock()
+	scheduleDB = db
+}
+
+func currentScheduleDB() *sql.DB {
+	scheduleDBMu.RLock()
+	defer scheduleDBMu.RUnlock()
+	return scheduleDB
+}
+
+// deferNotification schedules n for delivery at due
+func deferNotification(ctx context.Context, n *runtime.NotificationSend, due time.Time) error {
+	db := currentScheduleDB()
+	if db == nil {
+		return fmt.Errorf("notifier isn't initialized, can't defer notification %d", n.Code)
+	}
+	content, err := json.Marshal(n.Content)
+	if err != nil {
+		return err
+	}
+	return scheduler.Create(ctx, db, &scheduler.Schedule{
+		EventName: deferredEvent,
+		Properties: map[string]string{
+			"user_id":    n.UserID,
+			"code":       strconv.Itoa(n.Code),
+			"subject":    n.Subject,
+			"content":    string(content),
+			"sender":     n.Sender,
+			"persistent": strconv.FormatBool(n.Persistent),
+		},
+		DueAt: due,
+	})
+}
+
+// HandleDeferredNotification delivers a notification deferred by quiet
+// hours, unless the user opted out of it in the meantime
+func HandleDeferredNotification(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) error {
+	props := evt.GetProperties()
+	code, err := strconv.Atoi(props["code"])
+	if err != nil {
+		return fmt.Errorf("deferred notification has an invalid code %q", props["code"])
+	}
+	userID := props["user_id"]
+	prefs, err := GetPreferences(ctx, nk, userID)
+	if err != nil {
+		return err
+	}
+	if prefs.Codes[NotificationMessage(code)].Disabled {
+		logger.Debug("dropped deferred notification %d, %s opted out", code, userID)
+		return nil
+	}
+
+	var content map[string]interface{}
+	if err := json.Unmarshal([]byte(props["content"]), &content); err != nil {
+		return fmt.Errorf("deferred notification %d has invalid content: %w", code, err)
+	}
+	persistent, _ := strconv.ParseBool(props["persistent"])
+	return nk.NotificationsSend(ctx, []*runtime.NotificationSend{{
+		UserID:     userID,
+		Subject:    props["subject"],
+		Content:    content,
+		Code:       code,
+		Sender:     props["sender"],
+		Persistent: persistent,
+	}})
+}
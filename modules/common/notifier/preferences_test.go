@@ -0,0 +1,51 @@
+package notifier
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHoursUntil(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		quiet *QuietHours
+		now   time.Time
+		want  time.Time
+	}{
+		{name: "none", quiet: nil, now: at(10, 23, 0), want: time.Time{}},
+		{name: "invalid start", quiet: &QuietHours{Start: "25:00", End: "07:00"}, now: at(10, 23, 0), want: time.Time{}},
+		{name: "empty window", quiet: &QuietHours{Start: "07:00", End: "07:00"}, now: at(10, 7, 0), want: time.Time{}},
+		{name: "same day inside", quiet: &QuietHours{Start: "13:00", End: "15:30"}, now: at(10, 14, 0), want: at(10, 15, 30)},
+		{name: "same day at start", quiet: &QuietHours{Start: "13:00", End: "15:30"}, now: at(10, 13, 0), want: at(10, 15, 30)},
+		{name: "same day at end", quiet: &QuietHours{Start: "13:00", End: "15:30"}, now: at(10, 15, 30), want: time.Time{}},
+		{name: "same day before", quiet: &QuietHours{Start: "13:00", End: "15:30"}, now: at(10, 12, 59), want: time.Time{}},
+		{name: "across midnight before midnight", quiet: &QuietHours{Start: "22:00", End: "07:00"}, now: at(10, 23, 15), want: at(11, 7, 0)},
+		{name: "across midnight after midnight", quiet: &QuietHours{Start: "22:00", End: "07:00"}, now: at(11, 2, 0), want: at(11, 7, 0)},
+		{name: "across midnight at midnight", quiet: &QuietHours{Start: "22:00", End: "07:00"}, now: at(11, 0, 0), want: at(11, 7, 0)},
+		{name: "across midnight at start", quiet: &QuietHours{Start: "22:00", End: "07:00"}, now: at(10, 22, 0), want: at(11, 7, 0)},
+		{name: "across midnight at end", quiet: &QuietHours{Start: "22:00", End: "07:00"}, now: at(11, 7, 0), want: time.Time{}},
+		{name: "across midnight outside", quiet: &QuietHours{Start: "22:00", End: "07:00"}, now: at(10, 12, 0), want: time.Time{}},
+		{name: "across month end", quiet: &QuietHours{Start: "22:00", End: "07:00"}, now: at(31, 23, 0), want: time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC)},
+		{
+			name:  "account timezone",
+			quiet: &QuietHours{Start: "22:00", End: "07:00"},
+			now:   time.Date(2025, 3, 10, 23, 0, 0, 0, newYork),
+			want:  time.Date(2025, 3, 11, 7, 0, 0, 0, newYork),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.quiet.until(tt.now); !got.Equal(tt.want) {
+				t.Fatalf("until(%s) = %s, want %s", tt.now, got, tt.want)
+			}
+		})
+	}
+}
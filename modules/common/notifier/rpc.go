@@ -0,0 +1,144 @@
+package notifier
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/common/i18n"
+	"github.com/titan/titan-runtime/modules/common/validation"
+	"github.com/titan/titan-runtime/modules/utils"
+)
+
+const rpcTimeout = 5 * time.Second
+
+type getPreferencesRequest struct{}
+
+type updatePreferencesRequest struct {
+	Notifications []codePreferenceUpdate `json:"notifications" validate:"max=100"`
+	QuietHours    *quietHoursUpdate      `json:"quiet_hours"`
+}
+
+// codePreferenceUpdate changes the fields set, channel "default" goes back
+// to the template's persistence
+type codePreferenceUpdate struct {
+	Code    int     `json:"code" validate:"required"`
+	Enabled *bool   `json:"enabled"`
+	Channel *string `json:"channel" validate:"oneof=default socket inbox"`
+}
+
+// quietHoursUpdate replaces the quiet hours, an empty start and end turn
+// them off
+type quietHoursUpdate struct {
+	Start string `json:"start" validate:"pattern=^([01][0-9]|2[0-3]):[0-5][0-9]$"`
+	End   string `json:"end" validate:"pattern=^([01][0-9]|2[0-3]):[0-5][0-9]$"`
+}
+
+type notificationPreference struct {
+	Code    NotificationMessage `json:"code"`
+	Subject string              `json:"subject"`
+	Enabled bool                `json:"enabled"`
+	// Channel is where the notification is delivered, with the template
+	// default applied
+	Channel Channel `json:"channel"`
+	Default bool    `json:"default"`
+}
+
+type preferencesResponse struct {
+	Notifications []notificationPreference `json:"notifications"`
+	QuietHours    *QuietHours              `json:"quiet_hours,omitempty"`
+	Timezone      string                   `json:"timezone"`
+}
+
+// GetPreferencesHandler returns the caller's preferences for every
+// notification code
+func GetPreferencesHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *getPreferencesRequest) (*preferencesResponse, error) {
+	userID := utils.UserID(ctx)
+	prefs, err := GetPreferences(ctx, nk, userID)
+	if err != nil {
+		return nil, err
+	}
+	return preferencesFor(ctx, nk, logger, userID, prefs), nil
+}
+
+// UpdatePreferencesHandler applies the changes of the request to the
+// caller's preferences and returns them
+func UpdatePreferencesHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *updatePreferencesRequest) (*preferencesResponse, error) {
+	var errs validation.Errors
+	for i, u := range req.Notifications {
+		if _, ok := lookup(NotificationMessage(u.Code)); !ok {
+			errs = append(errs, validation.FieldError{Field: fmt.Sprintf("notifications[%d].code", i), Rule: "code", Message: "is not a notification code"})
+		}
+	}
+	if q := req.QuietHours; q != nil && (q.Start == "") != (q.End == "") {
+		errs = append(errs, validation.FieldError{Field: "quiet_hours", Rule: "required", Message: "needs both start and end"})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	userID := utils.UserID(ctx)
+	prefs, err := GetPreferences(ctx, nk, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range req.Notifications {
+		code := NotificationMessage(u.Code)
+		pref := prefs.Codes[code]
+		if u.Enabled != nil {
+			pref.Disabled = !*u.Enabled
+		}
+		if u.Channel != nil {
+			pref.Channel = Channel(*u.Channel)
+			if *u.Channel == "default" {
+				pref.Channel = ChannelDefault
+			}
+		}
+		if pref == (CodePreference{}) {
+			delete(prefs.Codes, code)
+		} else {
+			prefs.Codes[code] = pref
+		}
+	}
+	if q := req.QuietHours; q != nil {
+		prefs.QuietHours = nil
+		if q.Start != "" && q.Start != q.End {
+			prefs.QuietHours = &QuietHours{Start: q.Start, End: q.End}
+		}
+	}
+
+	if err := SavePreferences(ctx, nk, userID, prefs); err != nil {
+		return nil, err
+	}
+	logger.Info("updated notification preferences of %s", userID)
+	return preferencesFor(ctx, nk, logger, userID, prefs), nil
+}
+
+func preferencesFor(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, userID string, prefs *Preferences) *preferencesResponse {
+	locale := i18n.UserLocale(ctx, nk, logger, userID)
+	resp := &preferencesResponse{
+		QuietHours: prefs.QuietHours,
+		Timezone:   userLocation(ctx, nk, logger, userID).String(),
+	}
+	for _, code := range Codes() {
+		t, _ := lookup(code)
+		pref, custom := prefs.Codes[code]
+		channel := pref.Channel
+		if channel == ChannelDefault {
+			channel = ChannelSocket
+			if t.Persistent {
+				channel = ChannelInbox
+			}
+		}
+		resp.Notifications = append(resp.Notifications, notificationPreference{
+			Code:    code,
+			Subject: i18n.T(locale, t.Subject),
+			Enabled: !pref.Disabled,
+			Channel: channel,
+			Default: !custom,
+		})
+	}
+	return resp
+}
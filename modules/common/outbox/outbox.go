@@ -0,0 +1,272 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/config"
+	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+)
+
+// ---- transactional outbox ----
+// events are inserted into the outbox table in the same transaction as
+// the state change they describe, a background relay then publishes them
+// through nk.Event and marks them delivered. An enqueued event is
+// published once its transaction committed; it may be published more than
+// once if a node dies between publishing and marking, which the event
+// processor drops through the idempotency key fixed at enqueue time.
+// Emit can't share a transaction with changes made through nakama's api,
+// so its callers return the error instead of losing the event silently.
+//
+// A failed publish is retried with exponential backoff (next_attempt_at),
+// so failing rows don't hold up the ones behind them. After maxAttempts
+// the row is moved to the titan_event_outbox_dead_letters table.
+
+const (
+	relayIntervalEnv     = "OUTBOX_RELAY_INTERVAL"
+	defaultRelayInterval = time.Second
+	relayBatchSize       = 100
+	// delivered rows are kept this long for debugging
+	deliveredRetention = 7 * 24 * time.Hour
+	purgeInterval      = time.Hour
+
+	maxAttempts = 10
+)
+
+const createOutboxTableQuery = `
+CREATE TABLE IF NOT EXISTS titan_event_outbox (
+	id              BIGSERIAL    PRIMARY KEY,
+	event_id        VARCHAR(64)  NOT NULL UNIQUE,
+	event_name      VARCHAR(128) NOT NULL,
+	properties      JSONB        NOT NULL,
+	created_at      TIMESTAMPTZ  NOT NULL DEFAULT now(),
+	attempts        INT          NOT NULL DEFAULT 0,
+	last_error      TEXT,
+	delivered_at    TIMESTAMPTZ,
+	next_attempt_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+)`
+
+const migrateOutboxTableQuery = `
+ALTER TABLE titan_event_outbox ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now()`
+
+const createDeadLetterTableQuery = `
+CREATE TABLE IF NOT EXISTS titan_event_outbox_dead_letters (
+	id         BIGINT       PRIMARY KEY,
+	event_id   VARCHAR(64)  NOT NULL,
+	event_name VARCHAR(128) NOT NULL,
+	properties JSONB        NOT NULL,
+	created_at TIMESTAMPTZ  NOT NULL,
+	attempts   INT          NOT NULL,
+	last_error TEXT,
+	dead_at    TIMESTAMPTZ  NOT NULL DEFAULT now()
+)`
+
+const createOutboxPendingIndexQuery = `
+CREATE INDEX IF NOT EXISTS titan_event_outbox_pending_idx
+	ON titan_event_outbox (id) WHERE delivered_at IS NULL`
+
+const insertOutboxQuery = `
+INSERT INTO titan_event_outbox (event_id, event_name, properties) VALUES ($1, $2, $3)`
+
+// rows locked by another node's relay are skipped, so every row is
+// published by a single node at a time
+const selectPendingQuery = `
+SELECT id, event_name, properties, attempts FROM titan_event_outbox
+WHERE delivered_at IS NULL AND next_attempt_at <= now()
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED`
+
+const markDeliveredQuery = `
+UPDATE titan_event_outbox SET delivered_at = now(), attempts = attempts + 1 WHERE id = $1`
+
+// the backoff doubles from a second up to ten minutes
+const markFailedQuery = `
+UPDATE titan_event_outbox
+SET attempts = attempts + 1, last_error = $2,
+	next_attempt_at = now() + LEAST(interval '1 second' * power(2, attempts), interval '10 minutes')
+WHERE id = $1`
+
+const deadLetterQuery = `
+WITH dead AS (
+	DELETE FROM titan_event_outbox WHERE id = $1
+	RETURNING id, event_id, event_name, properties, created_at, attempts, last_error
+)
+INSERT INTO titan_event_outbox_dead_letters (id, event_id, event_name, properties, created_at, attempts, last_error)
+SELECT id, event_id, event_name, properties, created_at, attempts + 1, $2 FROM dead`
+
+const purgeDeliveredQuery = `
+DELETE FROM titan_event_outbox WHERE delivered_at IS NOT NULL AND delivered_at < $1`
+
+func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	logger.Info("Initializing Outbox domain...")
+	if _, err := db.ExecContext(ctx, createOutboxTableQuery); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, migrateOutboxTableQuery); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, createOutboxPendingIndexQuery); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, createDeadLetterTableQuery); err != nil {
+		return err
+	}
+
+	interval := defaultRelayInterval
+	if v := config.Env(ctx, relayIntervalEnv, ""); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return errors.New("invalid " + relayIntervalEnv + ": " + v)
+		}
+		interval = d
+	}
+	startRelay(ctx, logger, db, nk, interval)
+
+	logger.Info("Outbox domain initialized, relaying every %s", interval)
+	return nil
+}
+
+// Enqueue writes the event into the outbox as part of tx. The envelope is
+// assigned now, so the event keeps its id however often it is relayed.
+func Enqueue(ctx context.Context, tx *sql.Tx, eventName string, properties map[string]string) error {
+	evt := eventEmitter.BuildEvent(ctx, eventName, properties)
+	props, err := json.Marshal(evt.GetProperties())
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, insertOutboxQuery, evt.GetProperties()[eventEmitter.PropEventID], eventName, props)
+	return err
+}
+
+// WithTx runs fn in a transaction, committing it when fn succeeds
+func WithTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// Emit enqueues a single event in a transaction of its own, for callers
+// whose state change doesn't go through the database handle. The change
+// is already committed, so a failed Emit must be reported to the caller.
+func Emit(ctx context.Context, db *sql.DB, eventName string, properties map[string]string) error {
+	return WithTx(ctx, db, func(tx *sql.Tx) error {
+		return Enqueue(ctx, tx, eventName, properties)
+	})
+}
+
+func startRelay(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lastPurge := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// keep draining while full batches go through
+			for {
+				delivered, err := relayBatch(ctx, logger, db, nk)
+				if err != nil {
+					logger.Error("outbox relay failed: %v", err)
+					break
+				}
+				if delivered < relayBatchSize {
+					break
+				}
+			}
+
+			if time.Since(lastPurge) >= purgeInterval {
+				lastPurge = time.Now()
+				if _, err := db.ExecContext(ctx, purgeDeliveredQuery, time.Now().Add(-deliveredRetention)); err != nil {
+					logger.Warn("failed to purge delivered outbox events: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+type pendingEvent struct {
+	id       int64
+	name     string
+	props    []byte
+	attempts int
+}
+
+// relayBatch publishes one batch of pending events and returns how many
+// were delivered
+func relayBatch(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) (delivered int, err error) {
+	err = WithTx(ctx, db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, selectPendingQuery, relayBatchSize)
+		if err != nil {
+			return err
+		}
+		var pending []pendingEvent
+		for rows.Next() {
+			var p pendingEvent
+			if err := rows.Scan(&p.id, &p.name, &p.props, &p.attempts); err != nil {
+				rows.Close()
+				return err
+			}
+			pending = append(pending, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, p := range pending {
+			if publishErr := publish(ctx, nk, p); publishErr != nil {
+				logger.Warn("failed to relay outbox event %d (%s): %v", p.id, p.name, publishErr)
+				nk.MetricsCounterAdd("outbox_relay_failures", map[string]string{"event": p.name}, 1)
+				if p.attempts+1 >= maxAttempts {
+					logger.Error("outbox event %d (%s) failed %d times, moving it to the dead letters", p.id, p.name, maxAttempts)
+					nk.MetricsCounterAdd("outbox_dead_letters", map[string]string{"event": p.name}, 1)
+					if _, err := tx.ExecContext(ctx, deadLetterQuery, p.id, publishErr.Error()); err != nil {
+						return err
+					}
+					continue
+				}
+				if _, err := tx.ExecContext(ctx, markFailedQuery, p.id, publishErr.Error()); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, markDeliveredQuery, p.id); err != nil {
+				return err
+			}
+			delivered++
+		}
+		return nil
+	})
+	return delivered, err
+}
+
+func publish(ctx context.Context, nk runtime.NakamaModule, p pendingEvent) error {
+	var props map[string]string
+	if err := json.Unmarshal(p.props, &props); err != nil {
+		return err
+	}
+	return nk.Event(ctx, &api.Event{
+		Name:       p.name,
+		Properties: props,
+		External:   false,
+	})
+}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// InitFunc is the signature every domain InitModule already follows
+type InitFunc func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error
+
+// Module is a single domain init step. Required modules abort the plugin
+// load when they fail, optional ones are logged and skipped.
+type Module struct {
+	Name     string
+	Init     InitFunc
+	Optional bool
+}
+
+// Result records the outcome of one module init
+type Result struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// Run initializes the modules in the declared order and stops at the first
+// required module that fails, the modules after it may rely on what it
+// registers. Optional modules that fail are skipped.
+func Run(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer, modules []Module) ([]Result, error) {
+	results := make([]Result, 0, len(modules))
+
+	for _, m := range modules {
+		start := time.Now()
+		err := m.Init(ctx, logger, db, nk, initializer)
+		elapsed := time.Since(start)
+		results = append(results, Result{Name: m.Name, Duration: elapsed, Err: err})
+
+		status := "ok"
+		switch {
+		case err != nil && m.Optional:
+			status = "skipped"
+			logger.Warn("optional module %s failed to initialize in %s: %v", m.Name, elapsed, err)
+		case err != nil:
+			status = "failed"
+			logger.Error("module %s failed to initialize in %s: %v", m.Name, elapsed, err)
+		default:
+			logger.Info("module %s initialized in %s", m.Name, elapsed)
+		}
+		nk.MetricsTimerRecord("module_init", map[string]string{"module": m.Name, "status": status}, elapsed)
+		if status == "failed" {
+			return results, fmt.Errorf("module %s: %w", m.Name, err)
+		}
+	}
+
+	return results, nil
+}
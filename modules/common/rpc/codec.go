@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec converts typed requests and responses from and to rpc payloads
+type Codec interface {
+	Decode(payload string, v interface{}) error
+	Encode(v interface{}) (string, error)
+}
+
+var (
+	// JSON is the codec of typed rpcs unless registered otherwise, an empty
+	// payload decodes as {}
+	JSON Codec = jsonCodec{}
+	// Protobuf carries binary protobuf messages as base64 strings, both the
+	// request and the response type must be generated protobuf messages
+	Protobuf Codec = protobufCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Decode(payload string, v interface{}) error {
+	if strings.TrimSpace(payload) == "" {
+		payload = "{}"
+	}
+	return json.Unmarshal([]byte(payload), v)
+}
+
+func (jsonCodec) Encode(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Decode(payload string, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a protobuf message", v)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(payload))
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+func (protobufCodec) Encode(v interface{}) (string, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return "", fmt.Errorf("%T is not a protobuf message", v)
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
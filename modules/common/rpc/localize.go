@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/common/i18n"
+	shared "github.com/titan/titan-runtime/shared"
+)
+
+// Localize translates the message of rpc errors to the caller's locale.
+// Structured errors get their message and field messages translated,
+// messages without a translation stay in english.
+func Localize(id string, next Handler) Handler {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		resp, err := next(ctx, logger, db, nk, payload)
+		var rerr *runtime.Error
+		if err == nil || !errors.As(err, &rerr) {
+			return resp, err
+		}
+		return resp, LocalizeError(i18n.CallerLocale(ctx, nk, logger), rerr)
+	}
+}
+
+// LocalizeError returns err with its message translated to locale
+func LocalizeError(locale string, err *runtime.Error) *runtime.Error {
+	if strings.HasPrefix(err.Message, "{") {
+		var body shared.ErrorBody
+		if jsonErr := json.Unmarshal([]byte(err.Message), &body); jsonErr == nil && body.Message != "" {
+			fields := make([]shared.FieldError, len(body.Fields))
+			for i, f := range body.Fields {
+				f.Message = i18n.T(locale, f.Message)
+				fields[i] = f
+			}
+			if len(fields) == 0 {
+				fields = nil
+			}
+			return shared.NewStructuredError(i18n.T(locale, body.Message), err.Code, fields)
+		}
+	}
+	message := i18n.T(locale, err.Message)
+	if message == err.Message {
+		return err
+	}
+	return runtime.NewError(message, err.Code)
+}
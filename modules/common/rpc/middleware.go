@@ -0,0 +1,182 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/utils"
+	shared "github.com/titan/titan-runtime/shared"
+)
+
+var (
+	ErrUnauthenticated = runtime.NewError("authentication required", shared.UNAUTHENTICATED)
+	ErrDeadline        = runtime.NewError("request timed out", shared.DEADLINE_EXCEEDED)
+)
+
+// RequireAuth rejects calls without a user session
+func RequireAuth(id string, next Handler) Handler {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		if utils.UserID(ctx) == "" {
+			return "", ErrUnauthenticated
+		}
+		return next(ctx, logger, db, nk, payload)
+	}
+}
+
+// ServerOnly rejects calls that weren't made server to server (http_key)
+func ServerOnly(id string, next Handler) Handler {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		if !utils.IsServerToServer(ctx) {
+			return "", shared.ErrNotAllowed
+		}
+		return next(ctx, logger, db, nk, payload)
+	}
+}
+
+// Recover turns a handler panic into an INTERNAL error
+func Recover(id string, next Handler) Handler {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (resp string, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				resp, err = "", recovered(id, logger, nk, r)
+			}
+		}()
+		return next(ctx, logger, db, nk, payload)
+	}
+}
+
+func recovered(id string, logger runtime.Logger, nk runtime.NakamaModule, r interface{}) error {
+	logger.WithField("rpc", id).Error("rpc panicked: %v\n%s", r, debug.Stack())
+	nk.MetricsCounterAdd("rpc_panics", map[string]string{"rpc": id}, 1)
+	return shared.ErrInternalError
+}
+
+// Timeout gives the handler a deadline of d. The handler runs on the
+// calling goroutine and has to stop on its cancelled context, the call is
+// answered once it returned. A failure after the deadline is answered with
+// DEADLINE_EXCEEDED, a handler that still succeeded keeps its response.
+func Timeout(d time.Duration) Middleware {
+	return func(id string, next Handler) Handler {
+		return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			resp, err := next(ctx, logger, db, nk, payload)
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				logger.WithField("rpc", id).Warn("rpc exceeded its %s deadline: %v", d, err)
+				return "", ErrDeadline
+			}
+			return resp, err
+		}
+	}
+}
+
+// Metrics records the latency and result code of every call, tagged with
+// the rpc id and code
+func Metrics(id string, next Handler) Handler {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		start := time.Now()
+		resp, err := next(ctx, logger, db, nk, payload)
+		tags := map[string]string{"rpc": id, "code": strconv.Itoa(ErrorCode(err))}
+		nk.MetricsTimerRecord("rpc_latency", tags, time.Since(start))
+		nk.MetricsCounterAdd("rpc_calls", tags, 1)
+		return resp, err
+	}
+}
+
+const (
+	redacted       = "[REDACTED]"
+	maxLoggedBytes = 1024
+)
+
+// DefaultRedactedKeys are the payload keys Logging never writes out
+var DefaultRedactedKeys = []string{"password", "token", "secret", "email", "device_id", "authorization"}
+
+// Logging logs every call with its payload, response, duration and code.
+// Values of json keys containing one of redactKeys (case insensitive,
+// DefaultRedactedKeys when none are given) are replaced at any depth.
+// Payloads are logged at debug level, failures at warn.
+func Logging(redactKeys ...string) Middleware {
+	if len(redactKeys) == 0 {
+		redactKeys = DefaultRedactedKeys
+	}
+	keys := make([]string, len(redactKeys))
+	for i, k := range redactKeys {
+		keys[i] = strings.ToLower(k)
+	}
+
+	return func(id string, next Handler) Handler {
+		return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+			fields := map[string]interface{}{"rpc": id}
+			if userID := utils.UserID(ctx); userID != "" {
+				fields["user_id"] = userID
+			}
+			logger = logger.WithFields(fields)
+			logger.Debug("rpc request: %s", redactPayload(payload, keys))
+
+			start := time.Now()
+			resp, err := next(ctx, logger, db, nk, payload)
+			elapsed := time.Since(start)
+			if err != nil {
+				logger.Warn("rpc failed in %s with code %d: %v", elapsed, ErrorCode(err), err)
+				return resp, err
+			}
+			logger.Debug("rpc response in %s: %s", elapsed, redactPayload(resp, keys))
+			return resp, nil
+		}
+	}
+}
+
+func redactPayload(payload string, keys []string) string {
+	if payload == "" {
+		return payload
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(payload), &v); err != nil {
+		return fmt.Sprintf("<%d bytes, not json>", len(payload))
+	}
+	out, err := json.Marshal(redactValue(v, keys))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes>", len(payload))
+	}
+	if len(out) > maxLoggedBytes {
+		return string(out[:maxLoggedBytes]) + "...(truncated)"
+	}
+	return string(out)
+}
+
+func redactValue(v interface{}, keys []string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if isRedacted(k, keys) {
+				t[k] = redacted
+				continue
+			}
+			t[k] = redactValue(val, keys)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redactValue(val, keys)
+		}
+	}
+	return v
+}
+
+func isRedacted(key string, keys []string) bool {
+	key = strings.ToLower(key)
+	for _, k := range keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
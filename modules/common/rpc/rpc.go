@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	shared "github.com/titan/titan-runtime/shared"
+)
+
+// ---- rpc registration ----
+// domains register their rpcs through a Router from routes.go, every rpc
+// runs behind the router middleware (error localization, metrics, logging,
+// panic recovery by default) followed by its own, e.g.
+//
+//	router := rpc.NewRouter(initializer)
+//	router.Register("update_account", UpdateAccountHandler, rpc.RequireAuth, rpc.Timeout(5*time.Second))
+
+// Handler is the signature of nakama rpc functions
+type Handler func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error)
+
+// Middleware wraps the handler of the rpc id
+type Middleware func(id string, next Handler) Handler
+
+// Chain wraps h with mws, the first middleware runs first
+func Chain(id string, h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](id, h)
+	}
+	return h
+}
+
+// DefaultMiddleware is applied by routers created without middleware
+func DefaultMiddleware() []Middleware {
+	return []Middleware{Localize, Metrics, Logging(), Recover}
+}
+
+type Router struct {
+	initializer runtime.Initializer
+	middleware  []Middleware
+}
+
+// NewRouter returns a router applying mws to every rpc, DefaultMiddleware
+// when none are given
+func NewRouter(initializer runtime.Initializer, mws ...Middleware) *Router {
+	if len(mws) == 0 {
+		mws = DefaultMiddleware()
+	}
+	return &Router{initializer: initializer, middleware: mws}
+}
+
+// Use appends middleware for the rpcs registered from then on
+func (r *Router) Use(mws ...Middleware) *Router {
+	r.middleware = append(r.middleware, mws...)
+	return r
+}
+
+// Register registers h as rpc id behind the router middleware and mws
+func (r *Router) Register(id string, h Handler, mws ...Middleware) error {
+	all := make([]Middleware, 0, len(r.middleware)+len(mws))
+	all = append(all, r.middleware...)
+	all = append(all, mws...)
+	return r.initializer.RegisterRpc(id, Chain(id, h, all...))
+}
+
+// ErrorCode returns the code an rpc error is answered with, plain errors
+// are reported as INTERNAL by nakama
+func ErrorCode(err error) int {
+	if err == nil {
+		return shared.OK
+	}
+	var rerr *runtime.Error
+	if errors.As(err, &rerr) {
+		return rerr.Code
+	}
+	return shared.INTERNAL
+}
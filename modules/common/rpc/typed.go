@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/common/validation"
+	shared "github.com/titan/titan-runtime/shared"
+)
+
+// Func is a typed rpc, it gets the decoded and validated request
+type Func[Req, Resp any] func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *Req) (*Resp, error)
+
+var ErrCanceled = runtime.NewError("request canceled", shared.CANCELED)
+
+// Typed adapts fn to a Handler. The payload is decoded with codec and
+// validated with its validate tags, the response is encoded with codec and
+// errors are converted with ToError.
+func Typed[Req, Resp any](codec Codec, fn Func[Req, Resp]) Handler {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		req := new(Req)
+		if err := codec.Decode(payload, req); err != nil {
+			return "", shared.ErrBadInput
+		}
+		if err := validation.Struct(req); err != nil {
+			return "", ToError(logger, err)
+		}
+
+		resp, err := fn(ctx, logger, db, nk, req)
+		if err != nil {
+			return "", ToError(logger, err)
+		}
+		if resp == nil {
+			return "", nil
+		}
+		out, err := codec.Encode(resp)
+		if err != nil {
+			logger.Error("failed to encode rpc response: %v", err)
+			return "", shared.ErrInternalError
+		}
+		return out, nil
+	}
+}
+
+// Register registers a typed rpc with the JSON codec
+func Register[Req, Resp any](r *Router, id string, fn Func[Req, Resp], mws ...Middleware) error {
+	return r.Register(id, Typed(JSON, fn), mws...)
+}
+
+// RegisterCodec registers a typed rpc with codec
+func RegisterCodec[Req, Resp any](r *Router, id string, codec Codec, fn Func[Req, Resp], mws ...Middleware) error {
+	return r.Register(id, Typed(codec, fn), mws...)
+}
+
+// ToError converts a handler error to the runtime error the client gets.
+// Runtime errors are kept, validation and context errors map onto their
+// codes, anything else is logged and answered as INTERNAL.
+func ToError(logger runtime.Logger, err error) error {
+	if err == nil {
+		return nil
+	}
+	var rerr *runtime.Error
+	var verrs validation.Errors
+	switch {
+	case errors.As(err, &rerr):
+		return rerr
+	case errors.As(err, &verrs):
+		return validation.ToRuntimeError(verrs)
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrDeadline
+	case errors.Is(err, context.Canceled):
+		return ErrCanceled
+	}
+	logger.Error("rpc failed: %v", err)
+	return shared.ErrInternalError
+}
@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/common/validation"
+	shared "github.com/titan/titan-runtime/shared"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+	rpcTimeout       = 10 * time.Second
+)
+
+type scheduleEventRequest struct {
+	EventName  string            `json:"event_name" validate:"required,max=128"`
+	Properties map[string]string `json:"properties"`
+	// DueAt is unix seconds, Delay is a go duration relative to now
+	DueAt    int64  `json:"due_at" validate:"min=0"`
+	Delay    string `json:"delay"`
+	Cron     string `json:"cron" validate:"max=128"`
+	Timezone string `json:"timezone" validate:"max=64"`
+}
+
+type cancelScheduledEventRequest struct {
+	ID string `json:"id" validate:"required"`
+}
+
+type listScheduledEventsRequest struct {
+	Status    string `json:"status" validate:"oneof=pending completed cancelled"`
+	EventName string `json:"event_name"`
+	Limit     int    `json:"limit" validate:"min=0"`
+}
+
+type listScheduledEventsResponse struct {
+	Schedules []*Schedule `json:"schedules"`
+}
+
+func scheduleError(logger runtime.Logger, err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidSchedule):
+		return runtime.NewError(err.Error(), shared.INVALID_ARGUMENT)
+	case errors.Is(err, ErrNotFound):
+		return runtime.NewError(err.Error(), shared.NOT_FOUND)
+	case errors.Is(err, ErrNotPending):
+		return runtime.NewError(err.Error(), shared.FAILED_PRECONDITION)
+	}
+	logger.Error("schedule operation failed: %v", err)
+	return shared.ErrInternalError
+}
+
+func ScheduleEventHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req scheduleEventRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return "", err
+	}
+
+	s := &Schedule{
+		EventName:  req.EventName,
+		Properties: req.Properties,
+		Cron:       req.Cron,
+		Timezone:   req.Timezone,
+	}
+	switch {
+	case req.DueAt > 0 && req.Delay != "":
+		return "", runtime.NewError("due_at and delay are mutually exclusive", shared.INVALID_ARGUMENT)
+	case req.DueAt > 0:
+		s.DueAt = time.Unix(req.DueAt, 0).UTC()
+	case req.Delay != "":
+		d, err := time.ParseDuration(req.Delay)
+		if err != nil || d < 0 {
+			return "", runtime.NewError("invalid delay", shared.INVALID_ARGUMENT)
+		}
+		s.DueAt = time.Now().Add(d).UTC()
+	}
+
+	if err := Create(ctx, db, s); err != nil {
+		return "", scheduleError(logger, err)
+	}
+
+	responseJSON, err := json.Marshal(s)
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
+
+func CancelScheduledEventHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req cancelScheduledEventRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return "", err
+	}
+
+	if err := Cancel(ctx, db, req.ID); err != nil {
+		return "", scheduleError(logger, err)
+	}
+	return "{}", nil
+}
+
+func ListScheduledEventsHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req listScheduledEventsRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return "", err
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultListLimit
+	}
+	if req.Limit > maxListLimit {
+		req.Limit = maxListLimit
+	}
+
+	schedules, err := List(ctx, db, req.Status, req.EventName, req.Limit)
+	if err != nil {
+		return "", scheduleError(logger, err)
+	}
+	if schedules == nil {
+		schedules = []*Schedule{}
+	}
+
+	responseJSON, err := json.Marshal(listScheduledEventsResponse{Schedules: schedules})
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
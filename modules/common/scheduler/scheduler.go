@@ -0,0 +1,348 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/config"
+	"github.com/titan/titan-runtime/modules/common/cron"
+	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+	"github.com/titan/titan-runtime/modules/common/outbox"
+	"github.com/titan/titan-runtime/modules/common/rpc"
+	"github.com/titan/titan-runtime/modules/utils"
+)
+
+// ---- scheduled events ----
+// schedules are rows of their own table so they survive restarts. Every
+// node polls for due schedules, rows are locked with SKIP LOCKED and the
+// event is written to the outbox in the same transaction that advances
+// the schedule, so each occurrence is emitted exactly once across nodes.
+// A recurring schedule that was overdue (e.g. during downtime) fires once
+// and continues with its next occurrence after now.
+
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+
+	pollIntervalEnv     = "SCHEDULER_POLL_INTERVAL"
+	defaultPollInterval = time.Second
+	pollBatchSize       = 100
+
+	// ScheduleIDProp is added to the properties of every scheduled event
+	ScheduleIDProp = "schedule_id"
+)
+
+var (
+	ErrNotFound        = errors.New("schedule not found")
+	ErrNotPending      = errors.New("schedule is not pending")
+	ErrInvalidSchedule = errors.New("invalid schedule")
+)
+
+const createScheduleTableQuery = `
+CREATE TABLE IF NOT EXISTS titan_scheduled_events (
+	id            VARCHAR(64)  PRIMARY KEY,
+	event_name    VARCHAR(128) NOT NULL,
+	properties    JSONB        NOT NULL,
+	due_at        TIMESTAMPTZ  NOT NULL,
+	cron          VARCHAR(128) NOT NULL DEFAULT '',
+	timezone      VARCHAR(64)  NOT NULL DEFAULT 'UTC',
+	status        VARCHAR(16)  NOT NULL DEFAULT 'pending',
+	fire_count    INT          NOT NULL DEFAULT 0,
+	last_fired_at TIMESTAMPTZ,
+	created_at    TIMESTAMPTZ  NOT NULL DEFAULT now()
+)`
+
+const createScheduleDueIndexQuery = `
+CREATE INDEX IF NOT EXISTS titan_scheduled_events_due_idx
+	ON titan_scheduled_events (due_at) WHERE status = 'pending'`
+
+const insertScheduleQuery = `
+INSERT INTO titan_scheduled_events (id, event_name, properties, due_at, cron, timezone)
+VALUES ($1, $2, $3, $4, $5, $6)`
+
+const scheduleColumns = `id, event_name, properties, due_at, cron, timezone, status, fire_count, last_fired_at, created_at`
+
+const selectDueQuery = `
+SELECT ` + scheduleColumns + ` FROM titan_scheduled_events
+WHERE status = 'pending' AND due_at <= now()
+ORDER BY due_at
+LIMIT $1
+FOR UPDATE SKIP LOCKED`
+
+const advanceScheduleQuery = `
+UPDATE titan_scheduled_events
+SET due_at = $2, status = $3, fire_count = fire_count + 1, last_fired_at = now()
+WHERE id = $1`
+
+const cancelScheduleQuery = `
+UPDATE titan_scheduled_events SET status = 'cancelled' WHERE id = $1 AND status = 'pending'`
+
+const selectScheduleQuery = `
+SELECT ` + scheduleColumns + ` FROM titan_scheduled_events WHERE id = $1`
+
+const listSchedulesQuery = `
+SELECT ` + scheduleColumns + ` FROM titan_scheduled_events
+WHERE ($1 = '' OR status = $1) AND ($2 = '' OR event_name = $2)
+ORDER BY due_at
+LIMIT $3`
+
+type Schedule struct {
+	ID         string            `json:"id"`
+	EventName  string            `json:"event_name"`
+	Properties map[string]string `json:"properties"`
+	// DueAt is the next time the event fires, for recurring schedules it's
+	// computed from Cron when left empty
+	DueAt time.Time `json:"due_at"`
+	// Cron makes the schedule recurring, evaluated in Timezone
+	Cron        string     `json:"cron,omitempty"`
+	Timezone    string     `json:"timezone,omitempty"`
+	Status      string     `json:"status"`
+	FireCount   int        `json:"fire_count"`
+	LastFiredAt *time.Time `json:"last_fired_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	logger.Info("Initializing Scheduler domain...")
+	if _, err := db.ExecContext(ctx, createScheduleTableQuery); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, createScheduleDueIndexQuery); err != nil {
+		return err
+	}
+
+	interval := defaultPollInterval
+	if v := config.Env(ctx, pollIntervalEnv, ""); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return errors.New("invalid " + pollIntervalEnv + ": " + v)
+		}
+		interval = d
+	}
+
+	router := rpc.NewRouter(initializer).Use(rpc.ServerOnly, rpc.Timeout(rpcTimeout))
+	if err := router.Register("schedule_event", ScheduleEventHandler); err != nil {
+		return err
+	}
+	if err := router.Register("cancel_scheduled_event", CancelScheduledEventHandler); err != nil {
+		return err
+	}
+	if err := router.Register("list_scheduled_events", ListScheduledEventsHandler); err != nil {
+		return err
+	}
+
+	startPoller(ctx, logger, db, nk, interval)
+	logger.Info("Scheduler domain initialized, polling every %s", interval)
+	return nil
+}
+
+// Create stores a new schedule. One-off schedules need DueAt, recurring
+// ones need Cron and may set DueAt to delay their first occurrence.
+func Create(ctx context.Context, db *sql.DB, s *Schedule) error {
+	if s.EventName == "" {
+		return fmt.Errorf("%w: event_name is required", ErrInvalidSchedule)
+	}
+	if s.Timezone == "" {
+		s.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidSchedule, s.Timezone)
+	}
+
+	switch {
+	case s.Cron != "":
+		sched, err := cron.Parse(s.Cron)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+		if s.DueAt.IsZero() {
+			s.DueAt = sched.Next(time.Now().In(loc))
+		}
+		if s.DueAt.IsZero() {
+			return fmt.Errorf("%w: cron %q never fires", ErrInvalidSchedule, s.Cron)
+		}
+	case s.DueAt.IsZero():
+		return fmt.Errorf("%w: due_at or cron is required", ErrInvalidSchedule)
+	}
+
+	if s.Properties == nil {
+		s.Properties = make(map[string]string)
+	}
+	props, err := json.Marshal(s.Properties)
+	if err != nil {
+		return err
+	}
+
+	s.ID = utils.NewID()
+	s.Status = StatusPending
+	s.CreatedAt = time.Now().UTC()
+	_, err = db.ExecContext(ctx, insertScheduleQuery, s.ID, s.EventName, props, s.DueAt, s.Cron, s.Timezone)
+	return err
+}
+
+// Cancel stops a pending schedule from firing again
+func Cancel(ctx context.Context, db *sql.DB, id string) error {
+	res, err := db.ExecContext(ctx, cancelScheduleQuery, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		if _, err := Get(ctx, db, id); err != nil {
+			return err
+		}
+		return ErrNotPending
+	}
+	return nil
+}
+
+func Get(ctx context.Context, db *sql.DB, id string) (*Schedule, error) {
+	s, err := scanSchedule(db.QueryRowContext(ctx, selectScheduleQuery, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return s, err
+}
+
+// List returns schedules ordered by due time, status and eventName filter
+// when they aren't empty
+func List(ctx context.Context, db *sql.DB, status, eventName string, limit int) ([]*Schedule, error) {
+	rows, err := db.QueryContext(ctx, listSchedulesQuery, status, eventName, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*Schedule
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSchedule(row scanner) (*Schedule, error) {
+	var (
+		s         Schedule
+		props     []byte
+		lastFired sql.NullTime
+	)
+	if err := row.Scan(&s.ID, &s.EventName, &props, &s.DueAt, &s.Cron, &s.Timezone, &s.Status, &s.FireCount, &lastFired, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(props, &s.Properties); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule %s properties: %w", s.ID, err)
+	}
+	if lastFired.Valid {
+		s.LastFiredAt = &lastFired.Time
+	}
+	return &s, nil
+}
+
+func startPoller(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			for {
+				fired, err := fireDue(ctx, logger, nk, db)
+				if err != nil {
+					logger.Error("scheduler poll failed: %v", err)
+					break
+				}
+				if fired < pollBatchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// fireDue emits one batch of due schedules and returns how many fired
+func fireDue(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, db *sql.DB) (fired int, err error) {
+	err = outbox.WithTx(ctx, db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, selectDueQuery, pollBatchSize)
+		if err != nil {
+			return err
+		}
+		var due []*Schedule
+		for rows.Next() {
+			s, err := scanSchedule(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			due = append(due, s)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, s := range due {
+			props := make(map[string]string, len(s.Properties)+2)
+			for k, v := range s.Properties {
+				props[k] = v
+			}
+			props[ScheduleIDProp] = s.ID
+			props[eventEmitter.IdempotencyKeyProp] = fmt.Sprintf("schedule:%s:%d", s.ID, s.DueAt.Unix())
+			if err := outbox.Enqueue(ctx, tx, s.EventName, props); err != nil {
+				return err
+			}
+
+			nextDue, status := nextOccurrence(logger, s)
+			if _, err := tx.ExecContext(ctx, advanceScheduleQuery, s.ID, nextDue, status); err != nil {
+				return err
+			}
+			nk.MetricsCounterAdd("scheduled_events_fired", map[string]string{"event": s.EventName}, 1)
+			fired++
+		}
+		return nil
+	})
+	return fired, err
+}
+
+// nextOccurrence returns the next due time and status after s fired
+func nextOccurrence(logger runtime.Logger, s *Schedule) (time.Time, string) {
+	if s.Cron == "" {
+		return s.DueAt, StatusCompleted
+	}
+	sched, err := cron.Parse(s.Cron)
+	if err != nil {
+		logger.Error("schedule %s has an invalid cron %q, completing it: %v", s.ID, s.Cron, err)
+		return s.DueAt, StatusCompleted
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	from := s.DueAt
+	if now := time.Now(); now.After(from) {
+		from = now
+	}
+	next := sched.Next(from.In(loc))
+	if next.IsZero() {
+		return s.DueAt, StatusCompleted
+	}
+	return next, StatusPending
+}
@@ -0,0 +1,103 @@
+package schema
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileSuffix names schema files, <event name>.schema.json
+const FileSuffix = ".schema.json"
+
+// Registry keeps one schema per event name
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]*Schema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]*Schema)}
+}
+
+// Register sets the schema of an event, replacing any previous one
+func (r *Registry) Register(eventName string, s *Schema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[eventName] = s
+}
+
+// Get returns the schema of an event, nil when it has none
+func (r *Registry) Get(eventName string) *Schema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.schemas[eventName]
+}
+
+// LoadDir registers every *.schema.json file of dir and returns the event
+// names it loaded. Nothing is registered when one of the files is invalid.
+func (r *Registry) LoadDir(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+FileSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[string]*Schema, len(paths))
+	names := make([]string, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		s, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema %s: %w", path, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), FileSuffix)
+		loaded[name] = s
+		names = append(names, name)
+	}
+
+	for name, s := range loaded {
+		r.Register(name, s)
+	}
+	return names, nil
+}
+
+// Validate checks the properties of an event against its schema, events
+// without a schema are always valid. The error is a *ValidationError.
+func (r *Registry) Validate(eventName string, props map[string]string) error {
+	s := r.Get(eventName)
+	if s == nil {
+		return nil
+	}
+	if errs := s.Validate(props); len(errs) > 0 {
+		return &ValidationError{Event: eventName, Errors: errs}
+	}
+	return nil
+}
+
+// the registry the event processor enforces, domains load their schemas
+// into it from their InitModule
+var defaultRegistry = NewRegistry()
+
+// Register sets a schema on the shared registry, see Registry.Register
+func Register(eventName string, s *Schema) {
+	defaultRegistry.Register(eventName, s)
+}
+
+// Get returns a schema of the shared registry, see Registry.Get
+func Get(eventName string) *Schema {
+	return defaultRegistry.Get(eventName)
+}
+
+// LoadDir loads schema files into the shared registry, see Registry.LoadDir
+func LoadDir(dir string) ([]string, error) {
+	return defaultRegistry.LoadDir(dir)
+}
+
+// Validate checks an event against the shared registry, see Registry.Validate
+func Validate(eventName string, props map[string]string) error {
+	return defaultRegistry.Validate(eventName, props)
+}
@@ -0,0 +1,242 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ---- event property schemas ----
+// a schema describes the properties of one event type with a subset of
+// JSON Schema: required, properties (type, enum, const, pattern, minimum,
+// maximum, minLength, maxLength), additionalProperties and allOf with
+// if/then/else for cross-field rules. Event properties are always strings,
+// "type" says what the string must parse as. Reserved envelope properties
+// (prefixed with "_") are never validated.
+
+const (
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+)
+
+type Schema struct {
+	Title                string               `json:"title,omitempty"`
+	Description          string               `json:"description,omitempty"`
+	Required             []string             `json:"required,omitempty"`
+	Properties           map[string]*Property `json:"properties,omitempty"`
+	AdditionalProperties *bool                `json:"additionalProperties,omitempty"`
+	AllOf                []*Conditional       `json:"allOf,omitempty"`
+}
+
+type Property struct {
+	Type      string   `json:"type,omitempty"`
+	Enum      []string `json:"enum,omitempty"`
+	Const     *string  `json:"const,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Maximum   *float64 `json:"maximum,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Conditional applies Then when the properties match If, Else otherwise
+type Conditional struct {
+	If   *Schema `json:"if"`
+	Then *Schema `json:"then,omitempty"`
+	Else *Schema `json:"else,omitempty"`
+}
+
+// FieldError is a single failed constraint
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every failed constraint of an event
+type ValidationError struct {
+	Event  string       `json:"event"`
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return fmt.Sprintf("invalid %s event: %s", e.Event, strings.Join(msgs, "; "))
+}
+
+// Parse decodes a schema and compiles its patterns
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return nil, err
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Schema) compile() error {
+	for name, p := range s.Properties {
+		if p == nil {
+			return fmt.Errorf("property %s: empty definition", name)
+		}
+		switch p.Type {
+		case "", TypeString, TypeInteger, TypeNumber, TypeBoolean:
+		default:
+			return fmt.Errorf("property %s: unknown type %q", name, p.Type)
+		}
+		if p.Pattern != "" {
+			re, err := regexp.Compile(p.Pattern)
+			if err != nil {
+				return fmt.Errorf("property %s: invalid pattern: %w", name, err)
+			}
+			p.pattern = re
+		}
+		if p.Minimum != nil && p.Maximum != nil && *p.Minimum > *p.Maximum {
+			return fmt.Errorf("property %s: minimum is greater than maximum", name)
+		}
+	}
+	for i, c := range s.AllOf {
+		if c == nil || c.If == nil {
+			return fmt.Errorf("allOf[%d]: if is required", i)
+		}
+		for _, sub := range []*Schema{c.If, c.Then, c.Else} {
+			if sub == nil {
+				continue
+			}
+			if err := sub.compile(); err != nil {
+				return fmt.Errorf("allOf[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks props against the schema and returns the failed
+// constraints, sorted by field
+func (s *Schema) Validate(props map[string]string) []FieldError {
+	errs := s.validate(props)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+func (s *Schema) validate(props map[string]string) []FieldError {
+	var errs []FieldError
+
+	for _, key := range s.Required {
+		if v, ok := props[key]; !ok || v == "" {
+			errs = append(errs, FieldError{Field: key, Rule: "required", Message: "is required"})
+		}
+	}
+
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+		p, ok := s.Properties[key]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				errs = append(errs, FieldError{Field: key, Rule: "additionalProperties", Message: "is not allowed"})
+			}
+			continue
+		}
+		// an empty required value is already reported above
+		if props[key] == "" {
+			continue
+		}
+		errs = append(errs, p.validate(key, props[key])...)
+	}
+
+	for _, c := range s.AllOf {
+		branch := c.Else
+		if len(c.If.validate(props)) == 0 {
+			branch = c.Then
+		}
+		if branch != nil {
+			errs = append(errs, branch.validate(props)...)
+		}
+	}
+	return errs
+}
+
+func (p *Property) validate(field, value string) []FieldError {
+	var errs []FieldError
+	fail := func(rule, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var num float64
+	isNum := false
+	switch p.Type {
+	case TypeInteger:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			fail("type", "must be an integer, got %q", value)
+			return errs
+		}
+		num, isNum = float64(n), true
+	case TypeNumber:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			fail("type", "must be a number, got %q", value)
+			return errs
+		}
+		num, isNum = n, true
+	case TypeBoolean:
+		if _, err := strconv.ParseBool(value); err != nil {
+			fail("type", "must be a boolean, got %q", value)
+			return errs
+		}
+	}
+
+	if p.Const != nil && value != *p.Const {
+		fail("const", "must be %q", *p.Const)
+	}
+	if len(p.Enum) > 0 && !contains(p.Enum, value) {
+		fail("enum", "must be one of %s, got %q", strings.Join(p.Enum, ", "), value)
+	}
+	if p.pattern != nil && !p.pattern.MatchString(value) {
+		fail("pattern", "must match %s", p.Pattern)
+	}
+	if p.MinLength != nil && len([]rune(value)) < *p.MinLength {
+		fail("minLength", "must be at least %d characters", *p.MinLength)
+	}
+	if p.MaxLength != nil && len([]rune(value)) > *p.MaxLength {
+		fail("maxLength", "must be at most %d characters", *p.MaxLength)
+	}
+	if isNum && p.Minimum != nil && num < *p.Minimum {
+		fail("minimum", "must be >= %v", *p.Minimum)
+	}
+	if isNum && p.Maximum != nil && num > *p.Maximum {
+		fail("maximum", "must be <= %v", *p.Maximum)
+	}
+	return errs
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const testSchema = `{
+  "required": ["user_id", "score"],
+  "additionalProperties": false,
+  "properties": {
+    "user_id": {"type": "string", "minLength": 3, "maxLength": 8},
+    "score": {"type": "integer", "minimum": 0, "maximum": 100},
+    "ratio": {"type": "number"},
+    "final": {"type": "boolean"},
+    "mode": {"enum": ["daily", "node"]},
+    "node": {"type": "integer"},
+    "code": {"pattern": "^[A-Z]{2}$"},
+    "version": {"const": "1"}
+  },
+  "allOf": [
+    {
+      "if": {"properties": {"mode": {"const": "node"}}, "required": ["mode"]},
+      "then": {"required": ["node"]}
+    }
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "valid", data: testSchema},
+		{name: "empty", data: `{}`},
+		{name: "unknown field", data: `{"requires": ["a"]}`, wantErr: true},
+		{name: "unknown type", data: `{"properties": {"a": {"type": "object"}}}`, wantErr: true},
+		{name: "invalid pattern", data: `{"properties": {"a": {"pattern": "("}}}`, wantErr: true},
+		{name: "minimum above maximum", data: `{"properties": {"a": {"type": "integer", "minimum": 2, "maximum": 1}}}`, wantErr: true},
+		{name: "empty property", data: `{"properties": {"a": null}}`, wantErr: true},
+		{name: "conditional without if", data: `{"allOf": [{"then": {}}]}`, wantErr: true},
+		{name: "invalid json", data: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+	r.Register("scored", s)
+
+	tests := []struct {
+		name  string
+		event string
+		props map[string]string
+		want  []FieldError
+	}{
+		{name: "valid", event: "scored", props: map[string]string{"user_id": "abcd", "score": "10"}},
+		{name: "no schema", event: "other", props: map[string]string{"anything": "goes"}},
+		{name: "envelope properties are skipped", event: "scored", props: map[string]string{"user_id": "abcd", "score": "10", "_event_id": "x"}},
+		{
+			name:  "missing required",
+			event: "scored",
+			props: map[string]string{"score": "1"},
+			want:  []FieldError{{Field: "user_id", Rule: "required", Message: "is required"}},
+		},
+		{
+			name:  "empty required",
+			event: "scored",
+			props: map[string]string{"user_id": "", "score": "1"},
+			want:  []FieldError{{Field: "user_id", Rule: "required", Message: "is required"}},
+		},
+		{
+			name:  "additional property",
+			event: "scored",
+			props: map[string]string{"user_id": "abcd", "score": "1", "extra": "1"},
+			want:  []FieldError{{Field: "extra", Rule: "additionalProperties", Message: "is not allowed"}},
+		},
+		{
+			name:  "types",
+			event: "scored",
+			props: map[string]string{"user_id": "abcd", "score": "1.5", "ratio": "x", "final": "maybe"},
+			want: []FieldError{
+				{Field: "final", Rule: "type", Message: `must be a boolean, got "maybe"`},
+				{Field: "ratio", Rule: "type", Message: `must be a number, got "x"`},
+				{Field: "score", Rule: "type", Message: `must be an integer, got "1.5"`},
+			},
+		},
+		{
+			name:  "ranges and lengths",
+			event: "scored",
+			props: map[string]string{"user_id": "ab", "score": "101"},
+			want: []FieldError{
+				{Field: "score", Rule: "maximum", Message: "must be <= 100"},
+				{Field: "user_id", Rule: "minLength", Message: "must be at least 3 characters"},
+			},
+		},
+		{
+			name:  "enum pattern and const",
+			event: "scored",
+			props: map[string]string{"user_id": "abcd", "score": "1", "mode": "weekly", "code": "abc", "version": "2"},
+			want: []FieldError{
+				{Field: "code", Rule: "pattern", Message: "must match ^[A-Z]{2}$"},
+				{Field: "mode", Rule: "enum", Message: `must be one of daily, node, got "weekly"`},
+				{Field: "version", Rule: "const", Message: `must be "1"`},
+			},
+		},
+		{
+			name:  "conditional required",
+			event: "scored",
+			props: map[string]string{"user_id": "abcd", "score": "1", "mode": "node"},
+			want:  []FieldError{{Field: "node", Rule: "required", Message: "is required"}},
+		},
+		{name: "conditional not matched", event: "scored", props: map[string]string{"user_id": "abcd", "score": "1", "mode": "daily"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Validate(tt.event, tt.props)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate() = %v, want a *ValidationError", err)
+			}
+			if verr.Event != tt.event || !reflect.DeepEqual(verr.Errors, tt.want) {
+				t.Fatalf("Validate() = %+v, want %+v", verr.Errors, tt.want)
+			}
+		})
+	}
+}
@@ -2,13 +2,20 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/titan/titan-runtime/modules/common/models"
 )
 
+// AccountUpdateId updates the account of userID, empty strings and a nil
+// metadata leave the field unchanged
 func AccountUpdateId(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, userID string, userName string, avatarURL string, langTag string, metadata map[string]interface{}, displayName string, timezone string, location string) error {
-	return nk.AccountUpdateId(ctx, userID, userName, metadata, avatarURL, timezone, langTag, displayName, location)
+	if err := nk.AccountUpdateId(ctx, userID, userName, metadata, displayName, timezone, location, langTag, avatarURL); err != nil {
+		logger.Error("Error updating account: %v", err)
+		return err
+	}
+	return nil
 }
 
 func GetAccountId(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, userID string) (*models.Account, error) {
@@ -17,17 +24,48 @@ func GetAccountId(ctx context.Context, nk runtime.NakamaModule, logger runtime.L
 		logger.Error("Error getting account id: %v", err)
 		return nil, err
 	}
+	metadata, err := ParseAccountMetadata(resp.User.Metadata)
+	if err != nil {
+		logger.Error("Error parsing metadata of account %s: %v", userID, err)
+		return nil, err
+	}
 	return &models.Account{
 		UserID:      resp.User.Id,
 		Username:    resp.User.Username,
+		Email:       resp.Email,
 		DisplayName: resp.User.DisplayName,
 		AvatarURL:   resp.User.AvatarUrl,
 		LangTag:     resp.User.LangTag,
 		Location:    resp.User.Location,
 		Timezone:    resp.User.Timezone,
+		Metadata:    metadata,
+		CreatedAt:   resp.User.CreateTime.AsTime(),
+		UpdatedAt:   resp.User.UpdateTime.AsTime(),
 	}, nil
 }
 
+// ParseAccountMetadata flattens the account metadata json to strings,
+// values that aren't strings are kept as their json encoding
+func ParseAccountMetadata(raw string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if raw == "" {
+		return metadata, nil
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, err
+	}
+	for k, v := range values {
+		var str string
+		if err := json.Unmarshal(v, &str); err == nil {
+			metadata[k] = str
+			continue
+		}
+		metadata[k] = string(v)
+	}
+	return metadata, nil
+}
+
 func WalletUpdate(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, userID string, changeSet map[string]int64, metadata map[string]interface{}, persistent bool) (models.Wallet, models.Wallet, error) {
 	wallet1, wallet2, err := nk.WalletUpdate(ctx, userID, changeSet, metadata, persistent)
 	if err != nil {
@@ -35,10 +73,35 @@ func WalletUpdate(ctx context.Context, nk runtime.NakamaModule, logger runtime.L
 		return models.Wallet{}, models.Wallet{}, err
 	}
 	return models.Wallet{
-			Coins:    wallet1["coins"],
-			Diamonds: wallet1["diamonds"],
-		}, models.Wallet{
-			Coins:    wallet2["coins"],
-			Diamonds: wallet2["diamonds"],
-		}, nil
+		Coins:    wallet1["coins"],
+		Diamonds: wallet1["diamonds"],
+	}, models.Wallet{
+		Coins:    wallet2["coins"],
+		Diamonds: wallet2["diamonds"],
+	}, nil
+}
+
+// WalletUpdateWithRecord applies the changeset and writes record in a single
+// transaction, with a wallet ledger entry carrying metadata. Nothing is
+// applied when the record write fails, e.g. on a version conflict.
+func WalletUpdateWithRecord(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, userID string, changeSet map[string]int64, metadata map[string]interface{}, record *runtime.StorageWrite) (models.Wallet, models.Wallet, error) {
+	_, results, err := nk.MultiUpdate(ctx, nil, []*runtime.StorageWrite{record}, nil, []*runtime.WalletUpdate{{
+		UserID:    userID,
+		Changeset: changeSet,
+		Metadata:  metadata,
+	}}, true)
+	if err != nil {
+		logger.Error("Error updating wallet with record: %v", err)
+		return models.Wallet{}, models.Wallet{}, err
+	}
+	if len(results) == 0 {
+		return models.Wallet{}, models.Wallet{}, nil
+	}
+	return models.Wallet{
+		Coins:    results[0].Updated["coins"],
+		Diamonds: results[0].Updated["diamonds"],
+	}, models.Wallet{
+		Coins:    results[0].Previous["coins"],
+		Diamonds: results[0].Previous["diamonds"],
+	}, nil
 }
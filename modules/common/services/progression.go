@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/common/models"
+)
+
+const (
+	ProgressionCollection = "progression"
+	ProgressionKey        = "state"
+)
+
+// GetProgression reads the progression of userID and its storage version,
+// accounts without progression start at level 1 with an empty version
+func GetProgression(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, userID string) (*models.Progression, string, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: ProgressionCollection,
+		Key:        ProgressionKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		logger.Error("Error reading progression: %v", err)
+		return nil, "", err
+	}
+	if len(objects) == 0 {
+		return &models.Progression{Level: 1}, "", nil
+	}
+	var p models.Progression
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &p); err != nil {
+		return nil, "", err
+	}
+	return &p, objects[0].GetVersion(), nil
+}
+
+// WriteProgression stores the progression of userID if it's still at
+// version, an empty version only writes when there's no progression yet.
+// Players can read but never write it.
+func WriteProgression(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, userID string, p *models.Progression, version string) (string, error) {
+	value, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	if version == "" {
+		version = "*"
+	}
+	acks, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      ProgressionCollection,
+		Key:             ProgressionKey,
+		UserID:          userID,
+		Value:           string(value),
+		Version:         version,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	if err != nil {
+		logger.Error("Error writing progression: %v", err)
+		return "", err
+	}
+	return acks[0].Version, nil
+}
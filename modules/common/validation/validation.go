@@ -0,0 +1,329 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	shared "github.com/titan/titan-runtime/shared"
+)
+
+// ---- struct tag validation ----
+// request fields declare their constraints in a validate tag, e.g.
+//
+//	DisplayName string `json:"display_name" validate:"required,min=1,max=32"`
+//
+// Rules:
+//   - required: the field is set (non zero, or a non nil pointer)
+//   - min=n, max=n: length of strings (in characters), slices and maps,
+//     value of numbers
+//   - oneof=a b c: the value is one of the space separated options
+//   - url: an absolute http(s) url
+//   - pattern=re: the string matches re, it takes the rest of the tag so
+//     it must come last and may contain commas
+//
+// Rules other than required skip zero values, a nil pointer is skipped
+// while a set pointer is always checked so partial updates can't clear a
+// field by accident. Nested structs are validated as well, errors name the
+// field by its json path (e.g. "rewards[0].min_rank").
+
+const tagName = "validate"
+
+// FieldError is a single failed rule
+type FieldError = shared.FieldError
+
+// Errors lists every failed rule of a value
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + " " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type rule struct {
+	name    string
+	param   string
+	limit   float64
+	options []string
+	re      *regexp.Regexp
+}
+
+type field struct {
+	index    int
+	name     string
+	required bool
+	rules    []rule
+}
+
+// parsed rules per struct type
+var fieldCache sync.Map
+
+// Struct validates v, a struct or a pointer to one. The error is Errors
+// when v broke its rules, any other error is a malformed tag.
+func Struct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return errors.New("validation: nil value")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("validation: %s is not a struct", rv.Type())
+	}
+
+	var errs Errors
+	if err := validateStruct("", rv, &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Decode unmarshals a json rpc payload into v and validates it, an empty
+// payload decodes as {}. The returned error is ready to be returned from
+// the rpc.
+func Decode(payload string, v interface{}) error {
+	if strings.TrimSpace(payload) == "" {
+		payload = "{}"
+	}
+	if err := json.Unmarshal([]byte(payload), v); err != nil {
+		return shared.ErrBadInput
+	}
+	return ToRuntimeError(Struct(v))
+}
+
+// ToRuntimeError maps validation errors onto an INVALID_ARGUMENT error with
+// the field errors in a structured body
+func ToRuntimeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var errs Errors
+	if errors.As(err, &errs) {
+		return shared.NewStructuredError("invalid request", shared.INVALID_ARGUMENT, errs)
+	}
+	return shared.ErrInternalError
+}
+
+func validateStruct(path string, rv reflect.Value, errs *Errors) error {
+	fields, err := fieldsOf(rv.Type())
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if err := validateField(joinPath(path, f.name), rv.Field(f.index), f, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateField(path string, fv reflect.Value, f field, errs *Errors) error {
+	explicit := false
+	if fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			if f.required {
+				*errs = append(*errs, FieldError{Field: path, Rule: "required", Message: "is required"})
+			}
+			return nil
+		}
+		fv, explicit = fv.Elem(), true
+	}
+
+	if fv.IsZero() && !explicit {
+		if f.required {
+			*errs = append(*errs, FieldError{Field: path, Rule: "required", Message: "is required"})
+		}
+		return nil
+	}
+	for _, r := range f.rules {
+		if msg := r.check(fv); msg != "" {
+			*errs = append(*errs, FieldError{Field: path, Rule: r.name, Message: msg})
+		}
+	}
+	return validateNested(path, fv, errs)
+}
+
+func validateNested(path string, v reflect.Value, errs *Errors) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return validateNested(path, v.Elem(), errs)
+	case reflect.Struct:
+		return validateStruct(path, v, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateNested(fmt.Sprintf("%s[%d]", path, i), v.Index(i), errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r rule) check(v reflect.Value) string {
+	switch r.name {
+	case "min", "max":
+		n, unit, ok := measure(v)
+		if !ok {
+			return "has no length or value to compare"
+		}
+		if r.name == "min" && n < r.limit {
+			return fmt.Sprintf("must be at least %s%s", r.param, unit)
+		}
+		if r.name == "max" && n > r.limit {
+			return fmt.Sprintf("must be at most %s%s", r.param, unit)
+		}
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, o := range r.options {
+			if s == o {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(r.options, ", ")
+	case "url":
+		if v.Kind() != reflect.String {
+			return "must be a string"
+		}
+		u, err := url.ParseRequestURI(v.String())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be a valid http(s) url"
+		}
+	case "pattern":
+		if v.Kind() != reflect.String || !r.re.MatchString(v.String()) {
+			return "must match " + r.param
+		}
+	}
+	return ""
+}
+
+// measure returns what min/max compare for v and the unit of the message
+func measure(v reflect.Value) (float64, string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), " items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	}
+	return 0, "", false
+}
+
+func fieldsOf(t reflect.Type) ([]field, error) {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]field), nil
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag, hasTag := sf.Tag.Lookup(tagName)
+		if tag == "-" || (!hasTag && !nestable(sf.Type)) {
+			continue
+		}
+		f := field{index: i, name: jsonName(sf)}
+		rules, required, err := parseTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("validation: %s.%s: %w", t.Name(), sf.Name, err)
+		}
+		f.rules, f.required = rules, required
+		fields = append(fields, f)
+	}
+
+	fieldCache.Store(t, fields)
+	return fields, nil
+}
+
+// nestable reports whether fields of type t may hold structs to validate
+func nestable(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+func parseTag(tag string) ([]rule, bool, error) {
+	var (
+		rules    []rule
+		required bool
+	)
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "pattern=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+		r := rule{name: name, param: param}
+		switch name {
+		case "":
+			continue
+		case "required":
+			required = true
+			continue
+		case "min", "max":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid %s parameter %q", name, param)
+			}
+			r.limit = n
+		case "oneof":
+			r.options = strings.Fields(param)
+			if len(r.options) == 0 {
+				return nil, false, errors.New("oneof needs at least one option")
+			}
+		case "url":
+		case "pattern":
+			re, err := regexp.Compile(param)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid pattern: %w", err)
+			}
+			r.re = re
+		default:
+			return nil, false, fmt.Errorf("unknown rule %q", name)
+		}
+		rules = append(rules, r)
+	}
+	return rules, required, nil
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
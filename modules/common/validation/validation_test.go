@@ -0,0 +1,151 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	shared "github.com/titan/titan-runtime/shared"
+)
+
+type testBracket struct {
+	MinRank int64 `json:"min_rank" validate:"required,min=1"`
+	MaxRank int64 `json:"max_rank" validate:"min=1"`
+}
+
+type testRequest struct {
+	Name     string        `json:"name" validate:"required,min=2,max=5"`
+	Mode     string        `json:"mode,omitempty" validate:"oneof=daily node"`
+	Avatar   *string       `json:"avatar,omitempty" validate:"url"`
+	Code     string        `json:"code,omitempty" validate:"pattern=^[a-z]{1,3}(,[a-z]{1,3})*$"`
+	Count    *int          `json:"count,omitempty" validate:"min=0,max=10"`
+	Tags     []string      `json:"tags,omitempty" validate:"max=2"`
+	Brackets []testBracket `json:"brackets,omitempty"`
+	Ignored  string        `json:"ignored,omitempty" validate:"-"`
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    []FieldError
+		badJSON bool
+	}{
+		{name: "valid", payload: `{"name": "ann", "mode": "node", "avatar": "https://cdn.example.com/a.png", "code": "ab,c", "count": 0}`},
+		{name: "empty payload", payload: "", want: []FieldError{{Field: "name", Rule: "required", Message: "is required"}}},
+		{name: "invalid json", payload: `{"name":`, badJSON: true},
+		{name: "wrong type", payload: `{"name": 1}`, badJSON: true},
+		{
+			name:    "lengths in characters",
+			payload: `{"name": "ééééééé"}`,
+			want:    []FieldError{{Field: "name", Rule: "max", Message: "must be at most 5 characters"}},
+		},
+		{
+			name:    "oneof",
+			payload: `{"name": "ann", "mode": "weekly"}`,
+			want:    []FieldError{{Field: "mode", Rule: "oneof", Message: "must be one of daily, node"}},
+		},
+		{
+			name:    "url",
+			payload: `{"name": "ann", "avatar": "ftp://example.com/a.png"}`,
+			want:    []FieldError{{Field: "avatar", Rule: "url", Message: "must be a valid http(s) url"}},
+		},
+		{
+			name:    "set pointer is checked",
+			payload: `{"name": "ann", "avatar": ""}`,
+			want:    []FieldError{{Field: "avatar", Rule: "url", Message: "must be a valid http(s) url"}},
+		},
+		{
+			name:    "pattern with commas",
+			payload: `{"name": "ann", "code": "ab,,c"}`,
+			want:    []FieldError{{Field: "code", Rule: "pattern", Message: "must match ^[a-z]{1,3}(,[a-z]{1,3})*$"}},
+		},
+		{
+			name:    "number range",
+			payload: `{"name": "ann", "count": 11}`,
+			want:    []FieldError{{Field: "count", Rule: "max", Message: "must be at most 10"}},
+		},
+		{
+			name:    "items",
+			payload: `{"name": "ann", "tags": ["a", "b", "c"]}`,
+			want:    []FieldError{{Field: "tags", Rule: "max", Message: "must be at most 2 items"}},
+		},
+		{
+			name:    "nested",
+			payload: `{"name": "ann", "brackets": [{"min_rank": 1}, {"max_rank": -1}]}`,
+			want: []FieldError{
+				{Field: "brackets[1].min_rank", Rule: "required", Message: "is required"},
+				{Field: "brackets[1].max_rank", Rule: "min", Message: "must be at least 1"},
+			},
+		},
+		{
+			name:    "every failed rule",
+			payload: `{"name": "a", "mode": "weekly"}`,
+			want: []FieldError{
+				{Field: "name", Rule: "min", Message: "must be at least 2 characters"},
+				{Field: "mode", Rule: "oneof", Message: "must be one of daily, node"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req testRequest
+			err := Decode(tt.payload, &req)
+			switch {
+			case tt.badJSON:
+				if err != shared.ErrBadInput {
+					t.Fatalf("Decode() = %v, want ErrBadInput", err)
+				}
+				return
+			case tt.want == nil:
+				if err != nil {
+					t.Fatalf("Decode() = %v, want nil", err)
+				}
+				return
+			}
+			var rerr *runtime.Error
+			if !errors.As(err, &rerr) || rerr.Code != shared.INVALID_ARGUMENT {
+				t.Fatalf("Decode() = %v, want an INVALID_ARGUMENT runtime error", err)
+			}
+			var body shared.ErrorBody
+			if err := json.Unmarshal([]byte(rerr.Message), &body); err != nil {
+				t.Fatalf("error message %q isn't a structured body: %v", rerr.Message, err)
+			}
+			if !reflect.DeepEqual(body.Fields, tt.want) {
+				t.Fatalf("Decode() fields = %+v, want %+v", body.Fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructMalformedTag(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{name: "unknown rule", v: &struct {
+			A string `validate:"requried"`
+		}{}},
+		{name: "invalid limit", v: &struct {
+			A string `validate:"min=x"`
+		}{}},
+		{name: "empty oneof", v: &struct {
+			A string `validate:"oneof="`
+		}{}},
+		{name: "invalid pattern", v: &struct {
+			A string `validate:"pattern=("`
+		}{}},
+		{name: "not a struct", v: "value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Struct(tt.v)
+			var errs Errors
+			if err == nil || errors.As(err, &errs) {
+				t.Fatalf("Struct() = %v, want a malformed tag error", err)
+			}
+		})
+	}
+}
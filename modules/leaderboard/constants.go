@@ -1,5 +1,38 @@
 package leaderboard
 
+import (
+	"time"
+
+	eventProcessor "github.com/titan/titan-runtime/modules/common/eventProcessor"
+	"github.com/titan/titan-runtime/modules/common/notifier"
+)
+
+const (
+	pageSize        = 200
+	adminRPCTimeout = 10 * time.Second
+	// bounds a season record write within the event handler
+	seasonWriteTimeout = 5 * time.Second
+)
+
+// leaderboard writes mostly fail on timeouts and contention, give them a
+// few more attempts than the default before dead-lettering
+var updateLeaderboardRetryPolicy = eventProcessor.RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+}
+
+// notification codes sent by the leaderboard domain
 const (
-	pageSize = 200
+	seasonRewardNotificationCode notifier.NotificationMessage = 100
 )
+
+var notificationTemplates = map[notifier.NotificationMessage]notifier.Template{
+	seasonRewardNotificationCode: {
+		Subject:    "Season rewards",
+		Body:       "You finished the season at rank {{.rank}}",
+		Persistent: true,
+		Audience:   notifier.AudienceSelf,
+	},
+}
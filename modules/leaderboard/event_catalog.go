@@ -0,0 +1,257 @@
+package leaderboard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// ---- event catalog ----
+// events are stored as system owned storage objects, one object per event,
+// keyed by the event id. Only the server can read or write them.
+
+const (
+	eventCatalogCollection = "leaderboard_events"
+	eventCatalogPageSize   = 100
+)
+
+type EventStatus string
+
+const (
+	EventStatusScheduled EventStatus = "scheduled"
+	EventStatusActive    EventStatus = "active"
+	EventStatusArchived  EventStatus = "archived"
+)
+
+var (
+	errEventNotFound      = errors.New("event not found")
+	errEventAlreadyExists = errors.New("event already exists")
+	errEventArchived      = errors.New("event is archived")
+	errInvalidEvent       = errors.New("invalid event")
+)
+
+type Event struct {
+	ID          string      `json:"id"`
+	NodeCount   int         `json:"node_count"`
+	SeasonEndTs int64       `json:"season_end_ts"`
+	StartTs     int64       `json:"start_ts"`
+	Status      EventStatus `json:"status"`
+	CreatedAt   int64       `json:"created_at"`
+	UpdatedAt   int64       `json:"updated_at"`
+	// FinalizeScheduleID is the schedule paying the season out at
+	// SeasonEndTs, set by the server
+	FinalizeScheduleID string `json:"finalize_schedule_id,omitempty"`
+}
+
+func (ev *Event) validate(meta *LBConfig) error {
+	var errs []string
+
+	if strings.TrimSpace(ev.ID) == "" {
+		errs = append(errs, "id is required")
+	}
+	if strings.ContainsAny(ev.ID, ": ") {
+		errs = append(errs, "id must not contain ':' or spaces")
+	}
+	if meta != nil && (ev.NodeCount < meta.Constraints.MinNodes || ev.NodeCount > meta.Constraints.MaxNodes) {
+		errs = append(errs, fmt.Sprintf("node_count must be between %d and %d", meta.Constraints.MinNodes, meta.Constraints.MaxNodes))
+	}
+	if ev.SeasonEndTs <= 0 {
+		errs = append(errs, "season_end_ts is required")
+	}
+	if ev.StartTs < 0 {
+		errs = append(errs, "start_ts must not be negative")
+	}
+	if ev.StartTs > 0 && ev.SeasonEndTs > 0 && ev.StartTs >= ev.SeasonEndTs {
+		errs = append(errs, "start_ts must be before season_end_ts")
+	}
+	switch ev.Status {
+	case EventStatusScheduled, EventStatusActive, EventStatusArchived:
+		// valid
+	default:
+		errs = append(errs, fmt.Sprintf("invalid status: %q", ev.Status))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %s", errInvalidEvent, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// readEvent returns the stored event along with its storage version,
+// the version is used for optimistic concurrency on updates
+func readEvent(ctx context.Context, nk runtime.NakamaModule, eventID string) (*Event, string, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: eventCatalogCollection,
+		Key:        eventID,
+	}})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(objects) == 0 {
+		return nil, "", errEventNotFound
+	}
+
+	var ev Event
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &ev); err != nil {
+		return nil, "", fmt.Errorf("failed to parse stored event %s: %w", eventID, err)
+	}
+	return &ev, objects[0].GetVersion(), nil
+}
+
+func writeEvent(ctx context.Context, nk runtime.NakamaModule, ev *Event, version string) error {
+	value, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      eventCatalogCollection,
+		Key:             ev.ID,
+		Value:           string(value),
+		Version:         version,
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	return err
+}
+
+// listEvents walks the whole catalog, archived events are skipped
+// unless includeArchived is set
+func listEvents(ctx context.Context, nk runtime.NakamaModule, includeArchived bool) ([]*Event, error) {
+	var (
+		events []*Event
+		cursor string
+	)
+	for {
+		objects, nextCursor, err := nk.StorageList(ctx, "", "", eventCatalogCollection, eventCatalogPageSize, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("error listing events (cursor=%q): %w", cursor, err)
+		}
+		for _, o := range objects {
+			var ev Event
+			if err := json.Unmarshal([]byte(o.GetValue()), &ev); err != nil {
+				return nil, fmt.Errorf("failed to parse stored event %s: %w", o.GetKey(), err)
+			}
+			if ev.Status == EventStatusArchived && !includeArchived {
+				continue
+			}
+			events = append(events, &ev)
+		}
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+	return events, nil
+}
+
+// registerEvent stores a new event, provisions its leaderboards and
+// schedules the season payout
+func registerEvent(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, ev *Event) error {
+	meta := currentLBConfig()
+	if ev.Status == "" {
+		ev.Status = EventStatusScheduled
+	}
+	if err := ev.validate(meta); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	ev.CreatedAt = now
+	ev.UpdatedAt = now
+	ev.FinalizeScheduleID = ""
+	if err := scheduleSeasonFinalization(ctx, db, ev); err != nil {
+		return err
+	}
+
+	// version "*" only writes when the object doesn't exist yet
+	if err := writeEvent(ctx, nk, ev, "*"); err != nil {
+		cancelSeasonFinalization(ctx, logger, db, ev.FinalizeScheduleID)
+		if _, _, readErr := readEvent(ctx, nk, ev.ID); readErr == nil {
+			return errEventAlreadyExists
+		}
+		return err
+	}
+	logger.Info("registered event %s", ev.ID)
+
+	if ev.Status == EventStatusArchived {
+		return nil
+	}
+	return createLeaderboardsForEvent(ctx, logger, nk, meta, *ev)
+}
+
+// updateEvent replaces the editable fields of an event and provisions any
+// leaderboards the change requires, e.g. new nodes. A new season_end_ts
+// moves the season payout. Leaderboards that already exist keep the
+// metadata they were created with, nakama has no way to update it, so
+// their season_end_ts is the one at creation: the catalog is the source of
+// truth and the payout reads season_end_ts from it, not from the board.
+func updateEvent(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, ev *Event) error {
+	meta := currentLBConfig()
+	existing, version, err := readEvent(ctx, nk, ev.ID)
+	if err != nil {
+		return err
+	}
+	if existing.Status == EventStatusArchived {
+		return errEventArchived
+	}
+	if ev.Status == "" {
+		ev.Status = existing.Status
+	}
+	if ev.NodeCount < existing.NodeCount {
+		return fmt.Errorf("%w: node_count cannot be reduced from %d to %d", errInvalidEvent, existing.NodeCount, ev.NodeCount)
+	}
+	if err := ev.validate(meta); err != nil {
+		return err
+	}
+
+	ev.CreatedAt = existing.CreatedAt
+	ev.UpdatedAt = time.Now().Unix()
+	ev.FinalizeScheduleID = existing.FinalizeScheduleID
+	rescheduled := ev.FinalizeScheduleID == "" || ev.SeasonEndTs != existing.SeasonEndTs
+	if rescheduled {
+		if err := scheduleSeasonFinalization(ctx, db, ev); err != nil {
+			return err
+		}
+	}
+	if err := writeEvent(ctx, nk, ev, version); err != nil {
+		if rescheduled {
+			cancelSeasonFinalization(ctx, logger, db, ev.FinalizeScheduleID)
+		}
+		return err
+	}
+	if rescheduled {
+		cancelSeasonFinalization(ctx, logger, db, existing.FinalizeScheduleID)
+	}
+	logger.Info("updated event %s", ev.ID)
+
+	if ev.Status == EventStatusArchived {
+		return nil
+	}
+	return createLeaderboardsForEvent(ctx, logger, nk, meta, *ev)
+}
+
+// archiveEvent marks an event as archived, its leaderboards are kept
+// so the standings stay readable
+func archiveEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, eventID string) (*Event, error) {
+	ev, version, err := readEvent(ctx, nk, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if ev.Status == EventStatusArchived {
+		return ev, nil
+	}
+
+	ev.Status = EventStatusArchived
+	ev.UpdatedAt = time.Now().Unix()
+	if err := writeEvent(ctx, nk, ev, version); err != nil {
+		return nil, err
+	}
+	logger.Info("archived event %s", ev.ID)
+	return ev, nil
+}
@@ -0,0 +1,204 @@
+package leaderboard
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	eventemitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+	eventProcessor "github.com/titan/titan-runtime/modules/common/eventProcessor"
+)
+
+// ---- leaderboard event log ----
+// every processed update_leaderboard event and every node reset write is
+// appended to an ordered log, so the node/daily/season boards can be rebuilt
+// from it
+
+const createEventLogTableQuery = `
+CREATE TABLE IF NOT EXISTS titan_leaderboard_event_log (
+	seq                   BIGSERIAL    PRIMARY KEY,
+	event_id              VARCHAR(64)  NOT NULL UNIQUE,
+	correlation_id        VARCHAR(64)  NOT NULL,
+	causation_id          VARCHAR(64)  NOT NULL DEFAULT '',
+	leaderboard_type      VARCHAR(16)  NOT NULL,
+	node_leaderboard_id   VARCHAR(128) NOT NULL DEFAULT '',
+	daily_leaderboard_id  VARCHAR(128) NOT NULL DEFAULT '',
+	season_leaderboard_id VARCHAR(128) NOT NULL DEFAULT '',
+	properties            JSONB        NOT NULL,
+	emitted_at            TIMESTAMPTZ  NOT NULL,
+	logged_at             TIMESTAMPTZ  NOT NULL DEFAULT now()
+)`
+
+const createEventLogIndexQuery = `
+CREATE INDEX IF NOT EXISTS titan_leaderboard_event_log_season_idx
+	ON titan_leaderboard_event_log (season_leaderboard_id, emitted_at)`
+
+// a dead letter replay processes the same event again, it's logged once
+const appendEventLogQuery = `
+INSERT INTO titan_leaderboard_event_log (
+	event_id, correlation_id, causation_id, leaderboard_type,
+	node_leaderboard_id, daily_leaderboard_id, season_leaderboard_id,
+	properties, emitted_at
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT (event_id) DO NOTHING`
+
+// root events are the ones nobody derived from another event, replaying
+// them re-creates the derived ones
+const selectRootEventsQuery = `
+SELECT seq, properties FROM titan_leaderboard_event_log
+WHERE season_leaderboard_id = $1
+	AND causation_id = ''
+	AND emitted_at >= $2 AND emitted_at < $3
+ORDER BY seq`
+
+const (
+	logTypeNodeCarryOver = "node_carry_over"
+	logTypeNodeWinner    = "node_winner"
+)
+
+type loggedEvent struct {
+	Seq        int64
+	Properties map[string]string
+}
+
+func createEventLogTable(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, createEventLogTableQuery); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, createEventLogIndexQuery)
+	return err
+}
+
+func appendEventLog(ctx context.Context, db *sql.DB, evt *api.Event) error {
+	env, _ := eventemitter.EnvelopeFromContext(ctx)
+	props := evt.GetProperties()
+	data, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+	emittedAt := env.EmittedAt
+	if emittedAt.IsZero() {
+		emittedAt = time.Now().UTC()
+	}
+
+	_, err = db.ExecContext(ctx, appendEventLogQuery,
+		env.EventID, env.CorrelationID, env.CausationID, props["leaderboard_type"],
+		props["node_leaderboard_id"], props["daily_leaderboard_id"], props["season_leaderboard_id"],
+		data, emittedAt)
+	return err
+}
+
+// withEventLog appends the events handler processed successfully. A failed
+// append is only logged, retrying the handler for it could double count.
+func withEventLog(db *sql.DB, handler eventProcessor.Handler) eventProcessor.Handler {
+	return func(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) error {
+		if err := handler(ctx, logger, nk, evt); err != nil {
+			return err
+		}
+		if err := appendEventLog(ctx, db, evt); err != nil {
+			logger.Error("failed to append %s event to the leaderboard event log: %v", evt.GetName(), err)
+			nk.MetricsCounterAdd("leaderboard_event_log_failures", nil, 1)
+		}
+		return nil
+	}
+}
+
+func listRootEvents(ctx context.Context, db *sql.DB, seasonLbId string, from, to time.Time) ([]loggedEvent, error) {
+	rows, err := db.QueryContext(ctx, selectRootEventsQuery, seasonLbId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []loggedEvent
+	for rows.Next() {
+		var (
+			e    loggedEvent
+			data []byte
+		)
+		if err := rows.Scan(&e.Seq, &data); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &e.Properties); err != nil {
+			return nil, fmt.Errorf("failed to parse logged event %d: %w", e.Seq, err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// appendNodeResetLog logs a node reset write as a root event. Its id is
+// derived from the reset and the write, a resumed reset logs it once. Like
+// withEventLog a failed append is only logged.
+func appendNodeResetLog(
+	ctx context.Context,
+	logger runtime.Logger,
+	db *sql.DB,
+	nk runtime.NakamaModule,
+	summary *nodeResetSummary,
+	cfg *nodeResetConfig,
+	op nodeResetOp,
+) {
+	logType := logTypeNodeCarryOver
+	if op.Kind == nodeResetOpWinner {
+		logType = logTypeNodeWinner
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%s:%s", summary.LeaderboardID, summary.Reset, op.Kind, op.OwnerID)))
+	env := eventemitter.Envelope{
+		EventID:       "node_reset:" + hex.EncodeToString(sum[:16]),
+		SchemaVersion: eventemitter.SchemaVersion,
+		EmittedAt:     time.Now().UTC(),
+	}
+	env.CorrelationID = env.EventID
+
+	evt := &api.Event{Name: "node_reset", Properties: map[string]string{
+		"leaderboard_type":      logType,
+		"node_leaderboard_id":   summary.LeaderboardID,
+		"daily_leaderboard_id":  cfg.DailyLeaderboardID,
+		"season_leaderboard_id": expandTemplate(currentLBConfig().Season.IDTemplate, map[string]string{"eventId": cfg.EventID}),
+		"user_id":               op.OwnerID,
+		"user_name":             op.Username,
+		"score":                 strconv.FormatInt(op.Score, 10),
+		"reset":                 strconv.FormatInt(summary.Reset, 10),
+	}}
+	if err := appendEventLog(eventemitter.WithEnvelope(ctx, env), db, evt); err != nil {
+		logger.Error("failed to append node reset %s of %s to the leaderboard event log: %v", op.Kind, op.OwnerID, err)
+		nk.MetricsCounterAdd("leaderboard_event_log_failures", nil, 1)
+	}
+}
+
+// nodeResetOpFromLog returns the node reset write of a logged event, false
+// for update_leaderboard events
+func nodeResetOpFromLog(props map[string]string) (nodeResetOp, bool) {
+	op := nodeResetOp{OwnerID: props["user_id"], Username: props["user_name"]}
+	switch props["leaderboard_type"] {
+	case logTypeNodeCarryOver:
+		op.Kind = nodeResetOpCarryOver
+	case logTypeNodeWinner:
+		op.Kind = nodeResetOpWinner
+	default:
+		return op, false
+	}
+	op.Score, _ = strconv.ParseInt(props["score"], 10, 64)
+	return op, true
+}
+
+// stripEnvelope drops the envelope of a logged event, the replay gives
+// every event a new one
+func stripEnvelope(props map[string]string) map[string]string {
+	out := make(map[string]string, len(props))
+	for k, v := range props {
+		if !strings.HasPrefix(k, "_") {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -2,22 +2,17 @@ package leaderboard
 
 import (
 	"context"
+	"fmt"
 	"strconv"
-	"time"
 
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
 	eventemitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
 )
 
-func processNodeLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) {
-	validationErr := validateNodeLeaderboardEventInputs(evt)
-	if validationErr != nil {
-		logger.Error(validationErr.Error())
-		return
-	}
-	// once the validations are done, you can safely ignore the validation checks
-	// as the validation logs any missing inputs and returns
+func processNodeLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) error {
+	// the properties were checked against update_leaderboard.schema.json
+	// before dispatch, parse errors can't happen here
 	props := evt.GetProperties()
 	nodeLbId := props["node_leaderboard_id"]
 	scoreStr := props["score"]
@@ -25,11 +20,39 @@ func processNodeLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk
 	userName := props["user_name"]
 
 	newScore, _ := parseScore(scoreStr)
-	oldBest := getCurrentScore(ctx, logger, nk, nodeLbId, userId)
+	current, err := getCurrentRecord(ctx, nk, nodeLbId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to read node leaderboard record: %w", err)
+	}
+
+	// the record names the event that wrote it and the improvement it made,
+	// a retry of that event (e.g. after the daily emit failed) forwards the
+	// same delta again instead of seeing no improvement
+	eventKey := ""
+	if env, ok := eventemitter.EnvelopeFromContext(ctx); ok {
+		eventKey = env.IdempotencyKey
+	}
+	if current != nil && eventKey != "" && current.Score == newScore {
+		meta, _ := parseLeaderboardMetadataValues(current.GetMetadata())
+		if key, _ := meta["source_event_key"].(string); key == eventKey {
+			delta, _ := meta["delta"].(float64)
+			logger.Debug("Node leaderboard record already written by this event; forwarding its delta")
+			return emitDailyLeaderboardEvent(ctx, logger, nk, props, int64(delta))
+		}
+	}
+
+	oldBest, carried := int64(0), int64(0)
+	if current != nil {
+		oldBest = current.Score
+		carried = carriedScore(current)
+	}
 	if newScore <= oldBest {
 		logger.Debug("No improvement in score; skipping update")
-		return
+		return nil
 	}
+	// a carried-over best was never added to the daily board, the daily
+	// gets the improvement over what the player scored this period
+	delta := newScore - (oldBest - carried)
 
 	if _, err := nk.LeaderboardRecordWrite(
 		ctx,
@@ -39,7 +62,9 @@ func processNodeLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk
 		newScore,
 		0,
 		map[string]interface{}{
-			"source_event": evt.GetName(),
+			"source_event":     evt.GetName(),
+			"source_event_key": eventKey,
+			"delta":            delta,
 		},
 		nil,
 	); err != nil {
@@ -48,29 +73,49 @@ func processNodeLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk
 				"properties": props,
 			},
 		).Error("Failed to write new record to node leaderboard " + err.Error())
-		return
+		return fmt.Errorf("failed to write node leaderboard record: %w", err)
 	}
 
-	delta := newScore - oldBest
 	logger.Info("Updated node leaderboard with new best score")
+	return emitDailyLeaderboardEvent(ctx, logger, nk, props, delta)
+}
 
-	// update existing properties for daily leaderboard
-	props["leaderboard_type"] = "daily"
-	props["delta"] = strconv.FormatInt(delta, 10)
-
-	if err := eventemitter.EmitEvent(ctx, nk, "update_leaderboard", props); err != nil {
-		logger.Error("Failed to emit daily leaderboard update event")
+// carriedScore returns the score a node reset carried into the record, 0
+// once the player improved on it
+func carriedScore(record *api.LeaderboardRecord) int64 {
+	meta, _ := parseLeaderboardMetadataValues(record.GetMetadata())
+	if source, _ := meta["source_event"].(string); source != "node_reset_carry_over" {
+		return 0
+	}
+	carried, _ := meta["carried"].(float64)
+	if int64(carried) != record.GetScore() {
+		return 0
 	}
-	return
+	return int64(carried)
 }
 
-func processDailyLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) {
-	validationErr := validateDailyLeaderboardEventInputs(evt)
-	if validationErr != nil {
-		logger.Error(validationErr.Error())
-		return
+// emitDailyLeaderboardEvent forwards a node improvement to the daily
+// leaderboard. The emitted event derives its idempotency key from the node
+// event and its properties, so forwarding the same delta twice is applied
+// once.
+func emitDailyLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, props map[string]string, delta int64) error {
+	// the daily event gets a copy, the delivered event is shared with the
+	// other subscribers and kept as is for retries and dead letters
+	daily := make(map[string]string, len(props)+1)
+	for k, v := range props {
+		daily[k] = v
 	}
+	daily["leaderboard_type"] = "daily"
+	daily["delta"] = strconv.FormatInt(delta, 10)
 
+	if err := eventemitter.EmitEvent(ctx, nk, "update_leaderboard", daily); err != nil {
+		logger.Error("Failed to emit daily leaderboard update event")
+		return fmt.Errorf("failed to emit daily leaderboard update event: %w", err)
+	}
+	return nil
+}
+
+func processDailyLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) error {
 	props := evt.GetProperties()
 	dailyLbId := props["daily_leaderboard_id"]
 	deltaStr := props["delta"]
@@ -80,7 +125,7 @@ func processDailyLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk
 	delta, _ := parseScore(deltaStr)
 	if delta == 0 {
 		logger.Debug("Delta is zero; skipping daily leaderboard update")
-		return
+		return nil
 	}
 
 	if _, err := nk.LeaderboardRecordWrite(
@@ -91,19 +136,14 @@ func processDailyLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk
 			"source_event": evt.GetName(),
 		}, nil); err != nil {
 		logger.Error("Failed to increment daily leaderboard score")
-		return
+		return fmt.Errorf("failed to increment daily leaderboard score: %w", err)
 	}
 
 	logger.Info("Updated daily leaderboard with delta")
+	return nil
 }
 
-func processSeasonLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) {
-	validationErr := validateSeasonLeaderboardEventInputs(evt)
-	if validationErr != nil {
-		logger.Error(validationErr.Error())
-		return
-	}
-
+func processSeasonLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) error {
 	props := evt.GetProperties()
 	seasonLbId := props["season_leaderboard_id"]
 	userId := props["user_id"]
@@ -115,18 +155,19 @@ func processSeasonLeaderboardEvent(ctx context.Context, logger runtime.Logger, n
 
 	if newScore <= oldBest {
 		logger.Debug("No improvement in score; skipping season leaderboard update")
-		return
+		return nil
 	}
 
-	ctx2, cancel := context.WithTimeout(context.Background(), 500*time.Microsecond)
+	writeCtx, cancel := context.WithTimeout(ctx, seasonWriteTimeout)
 	defer cancel()
-	if _, err := nk.LeaderboardRecordWrite(ctx2, seasonLbId, userId, userName, newScore, 0, map[string]interface{}{
+	if _, err := nk.LeaderboardRecordWrite(writeCtx, seasonLbId, userId, userName, newScore, 0, map[string]interface{}{
 		"source_event": evt.GetName(),
 		"from_daily":   props["source_daily_id"],
 	}, nil); err != nil {
 		logger.Error("Failed to write new record to season leaderboard")
-		return
+		return fmt.Errorf("failed to write season leaderboard record: %w", err)
 	}
 
 	logger.Info("Updated season leaderboard with new best score")
+	return nil
 }
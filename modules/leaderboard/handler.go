@@ -6,12 +6,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
+	eventProcessor "github.com/titan/titan-runtime/modules/common/eventProcessor"
+	"github.com/titan/titan-runtime/modules/common/schema"
 )
 
-// no logic on node leaderboard reset for now, place holder function
+// season leaderboardReset finalizes the season, the closing standings
+// are paid out using the reward brackets in the season metadata
 func handleSeasonLeaderboardReset(
 	ctx context.Context,
 	logger runtime.Logger,
@@ -20,12 +24,17 @@ func handleSeasonLeaderboardReset(
 	lb *api.Leaderboard,
 	resetUnix int64,
 ) error {
-	return nil
+	_, err := finalizeSeason(ctx, logger, nk, lb, resetUnix)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+	return err
 }
 
 // daily leaderboardReset update the season leaderboard
 // it takes the todays dailyleaderboard values and updates
-// season leaderboard
+// season leaderboard. Progress is checkpointed after every page, a failed
+// rollup resumes from its checkpoint and a completed one is skipped.
 func handleDailyLeaderboardReset(
 	ctx context.Context,
 	logger runtime.Logger,
@@ -34,11 +43,23 @@ func handleDailyLeaderboardReset(
 	lb *api.Leaderboard,
 	reset int64,
 ) error {
+	_, err := runDailyRollup(ctx, logger, db, nk, lb, reset)
+	return err
+}
+
+func runDailyRollup(
+	ctx context.Context,
+	logger runtime.Logger,
+	db *sql.DB,
+	nk runtime.NakamaModule,
+	lb *api.Leaderboard,
+	reset int64,
+) (*rollupState, error) {
 
 	validationErr := validateDailyLeaderboardResetInputs(ctx, db, nk, lb)
 	if validationErr != nil {
 		logger.Error(validationErr.Error())
-		return validationErr
+		return nil, validationErr
 	}
 
 	dailyLbId := lb.GetId()
@@ -46,20 +67,47 @@ func handleDailyLeaderboardReset(
 
 	associatedSeasonLbId, _ := metaData["season_leaderboard_id"]
 
-	var cursor string
-	totalProcessed := 0
+	state, err := readRollupState(ctx, nk, dailyLbId, reset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rollup checkpoint for %s: %w", dailyLbId, err)
+	}
+	// a failed rollup walked the whole board, only its failures are left
+	walked := false
+	switch {
+	case state == nil:
+		state = &rollupState{
+			DailyLeaderboardID:  dailyLbId,
+			SeasonLeaderboardID: associatedSeasonLbId,
+			Reset:               reset,
+			Status:              rollupStatusInProgress,
+			StartedAt:           time.Now().Unix(),
+		}
+	// rollups completed with failures before they were kept open are
+	// walked again, the season board keeps the best score
+	case state.Status == rollupStatusCompleted && state.Failed == 0:
+		logger.Info("daily leaderboard %s already rolled up for reset %d", dailyLbId, reset)
+		return state, nil
+	default:
+		logger.Info("resuming rollup of daily leaderboard %s for reset %d at cursor %q with %d failed owners",
+			dailyLbId, reset, state.Cursor, state.Failed)
+		walked = state.Status == rollupStatusFailed
+		state.Status = rollupStatusInProgress
+		if err := retryRollupFailures(ctx, logger, nk, state); err != nil {
+			return state, err
+		}
+	}
 
-	for {
+	for !walked {
 		records, _, nextCursor, _, err := nk.LeaderboardRecordsList(
 			ctx,
 			lb.GetId(),
 			nil,
 			pageSize,
-			cursor,
+			state.Cursor,
 			reset,
 		)
 		if err != nil {
-			return fmt.Errorf("error parsing through records (id=%s, cursor=%q): %w", dailyLbId, cursor, err)
+			return state, fmt.Errorf("error parsing through records (id=%s, cursor=%q): %w", dailyLbId, state.Cursor, err)
 		}
 
 		for _, r := range records {
@@ -74,23 +122,74 @@ func handleDailyLeaderboardReset(
 				nil,
 			); err != nil {
 				logger.Error(fmt.Sprintf("failed to write daily score to season score for user id %v: %s", r.GetOwnerId(), err))
+				state.recordFailure(r.GetOwnerId())
+				continue
 			}
 
-			totalProcessed++
+			state.Processed++
 		}
 
-		if nextCursor == "" {
-			break
+		// checkpoint the page before moving on
+		state.Cursor = nextCursor
+		if err := writeRollupState(ctx, nk, state); err != nil {
+			return state, fmt.Errorf("failed to checkpoint rollup of %s: %w", dailyLbId, err)
 		}
-		cursor = nextCursor
+
+		walked = nextCursor == ""
 	}
 
-	logger.Info("season leaderboard id : %s got updated from daily leaderboard : %v reset", dailyLbId, associatedSeasonLbId)
+	// the walk is done, failed owners keep the rollup open for a resume
+	state.Status = rollupStatusCompleted
+	if state.Failed > 0 {
+		state.Status = rollupStatusFailed
+	} else {
+		state.CompletedAt = time.Now().Unix()
+	}
+	if err := writeRollupState(ctx, nk, state); err != nil {
+		return state, fmt.Errorf("failed to checkpoint rollup of %s: %w", dailyLbId, err)
+	}
+
+	logger.Info("season leaderboard id : %s got updated from daily leaderboard : %v reset (processed=%d, failed=%d)",
+		associatedSeasonLbId, dailyLbId, state.Processed, state.Failed)
+	if state.Failed > 0 {
+		return state, fmt.Errorf("%d owners failed to roll up from %s, resume the rollup to retry them", state.Failed, dailyLbId)
+	}
+	return state, nil
+}
+
+// retryRollupFailures writes the daily scores of the owners that failed in
+// an earlier run to the season leaderboard again, the ones failing again
+// stay in the state
+func retryRollupFailures(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, state *rollupState) error {
+	failed := state.FailedOwnerIDs
+	state.FailedOwnerIDs = nil
+	state.Failed = 0
 
+	for start := 0; start < len(failed); start += pageSize {
+		owners := failed[start:min(start+pageSize, len(failed))]
+		_, records, _, _, err := nk.LeaderboardRecordsList(ctx, state.DailyLeaderboardID, owners, 1, "", state.Reset)
+		if err != nil {
+			// keep every owner not retried yet
+			for _, ownerID := range failed[start:] {
+				state.recordFailure(ownerID)
+			}
+			return fmt.Errorf("failed to read daily records of failed owners (id=%s): %w", state.DailyLeaderboardID, err)
+		}
+		for _, r := range records {
+			if _, err := nk.LeaderboardRecordWrite(ctx, state.SeasonLeaderboardID, r.GetOwnerId(), "", r.GetScore(), r.GetSubscore(), nil, nil); err != nil {
+				logger.Error(fmt.Sprintf("failed again to write daily score to season score for user id %v: %s", r.GetOwnerId(), err))
+				state.recordFailure(r.GetOwnerId())
+				continue
+			}
+			state.Processed++
+		}
+	}
 	return nil
 }
 
-// no logic on node leaderboard reset for now, place holder function
+// node leaderboardReset archives the closing standings, carries a share
+// of the best scores forward and feeds the node winners into the daily
+// leaderboard, as configured in the node metadata
 func handleNodeLeaderboardReset(
 	ctx context.Context,
 	logger runtime.Logger,
@@ -99,7 +198,11 @@ func handleNodeLeaderboardReset(
 	lb *api.Leaderboard,
 	resetUnix int64,
 ) error {
-	return nil
+	_, err := resetNodeLeaderboard(ctx, logger, db, nk, lb, resetUnix)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+	return err
 }
 
 func leaderBoardResetHandler(
@@ -136,22 +239,25 @@ func leaderBoardResetHandler(
 }
 
 // HandleUpdateLeaderBoardEvent routes incoming leaderboard update events to the appropriate handler
-func HandleUpdateLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) {
-	validationError := validateGenericLeaderboardEventInputs(evt)
-	if validationError != nil {
-		logger.Error(validationError.Error())
+func HandleUpdateLeaderboardEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) error {
+	// the event processor rejects events breaking the schema, handlers
+	// called directly (e.g. replays) check it here
+	if err := schema.Validate(evt.GetName(), evt.GetProperties()); err != nil {
+		logger.Error(err.Error())
+		return eventProcessor.Permanent(err)
 	}
 
 	props := evt.GetProperties()
-	leaderboardType, _ := props["leaderboard_type"]
+	leaderboardType := props["leaderboard_type"]
 	switch leaderboardType {
 	case "node":
-		processNodeLeaderboardEvent(ctx, logger, nk, evt)
+		return processNodeLeaderboardEvent(ctx, logger, nk, evt)
 	case "daily":
-		processDailyLeaderboardEvent(ctx, logger, nk, evt)
+		return processDailyLeaderboardEvent(ctx, logger, nk, evt)
 	case "season":
-		processSeasonLeaderboardEvent(ctx, logger, nk, evt)
+		return processSeasonLeaderboardEvent(ctx, logger, nk, evt)
 	default:
 		logger.Error("there is no default leaderboards, leaderboard_type must be passed")
+		return eventProcessor.Permanent(fmt.Errorf("invalid leaderboard_type: %q", leaderboardType))
 	}
 }
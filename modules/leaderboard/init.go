@@ -3,82 +3,87 @@ package leaderboard
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/config"
+	eventProcessor "github.com/titan/titan-runtime/modules/common/eventProcessor"
+	"github.com/titan/titan-runtime/modules/common/notifier"
+	"github.com/titan/titan-runtime/modules/common/schema"
 )
 
-// ---- types for meta config ----
-type LBConfig struct {
-	Version     int       `json:"version"`
-	Node        LBTypeCfg `json:"node"`
-	Daily       LBTypeCfg `json:"daily"`
-	Season      LBTypeCfg `json:"season"`
-	Constraints struct {
-		MinNodes int `json:"min_nodes"`
-		MaxNodes int `json:"max_nodes"`
-	} `json:"constraints"`
-}
-type LBTypeCfg struct {
-	IDTemplate string                 `json:"id_template"`
-	Sort       string                 `json:"sort"`
-	Operator   string                 `json:"operator"`
-	Reset      *string                `json:"reset"`
-	Metadata   map[string]interface{} `json:"metadata"`
-}
-
-// ---- event data type ----
-type Event struct {
-	ID          string
-	NodeCount   int
-	SeasonEndTs int64
-}
-
 // ---- init ----
 func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
-	// 1. load meta config
-	meta, err := loadLBConfig("modules/leaderboard/leaderboard_meta.json")
+	// 1. load and validate meta config, from storage or the configured path
+	source := lbConfigSource(config.Env(ctx, lbConfigSourceEnv, lbConfigSourceFile))
+	meta, err := loadLBConfigFrom(ctx, nk, source, lbConfigPath(ctx))
 	logger.Info("meta_data processing happened")
 	if err != nil {
 		logger.Error(fmt.Sprintf("Error occured: %s", err))
 		return err
 	}
+	setLBConfig(meta)
+
+	// 2. register the admin rpcs and the notifications sent
+	if err := registerRPCs(initializer); err != nil {
+		return err
+	}
+	for code, t := range notificationTemplates {
+		if err := notifier.Register(code, t); err != nil {
+			return err
+		}
+	}
+
+	// 3. load the event schemas kept next to the meta config and subscribe
+	// to leaderboard update events, processed events are appended to the
+	// event log for replays
+	schemaDir := filepath.Dir(lbConfigPath(ctx))
+	loaded, err := schema.LoadDir(schemaDir)
+	if err != nil {
+		return err
+	}
+	if schema.Get("update_leaderboard") == nil {
+		return fmt.Errorf("missing update_leaderboard%s in %s", schema.FileSuffix, schemaDir)
+	}
+	logger.Info("loaded event schemas %v from %s", loaded, schemaDir)
+	if err := createEventLogTable(ctx, db); err != nil {
+		return err
+	}
+	if err := eventProcessor.Subscribe("update_leaderboard", "leaderboard", withEventLog(db, HandleUpdateLeaderboardEvent)); err != nil {
+		return err
+	}
+	if err := eventProcessor.SetRetryPolicy("update_leaderboard", updateLeaderboardRetryPolicy); err != nil {
+		return err
+	}
+	if err := eventProcessor.Subscribe(finalizeSeasonEvent, "leaderboard", HandleFinalizeSeasonEvent); err != nil {
+		return err
+	}
 
-	// 2. get events from your event system (mocked here)
-	events := []Event{
-		{ID: "ipl_2025", NodeCount: 3, SeasonEndTs: 1748563200},
+	// 4. get the live events from the event catalog
+	events, err := listEvents(ctx, nk, false)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to list events from the event catalog: %v", err))
+		return err
 	}
 
 	logger.Info("starting creation of leaderboards")
-	// 3. create leaderboards per event
+	// 5. create leaderboards per event
 	for _, ev := range events {
-		if err := createLeaderboardsForEvent(ctx, logger, nk, meta, ev); err != nil {
+		if err := createLeaderboardsForEvent(ctx, logger, nk, meta, *ev); err != nil {
 			logger.Error(fmt.Sprintf("failed to create leaderboards for event %s: %v", ev.ID, err))
 		}
 	}
 	logger.Info("creation of leaderboards completed")
+	scheduleMissingFinalizations(ctx, logger, db, nk, events)
 
 	return nil
 }
 
 // ---- helpers ----
 
-func loadLBConfig(path string) (*LBConfig, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	var cfg LBConfig
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, err
-	}
-	return &cfg, nil
-}
-
 func createLeaderboardsForEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, meta *LBConfig, ev Event) error {
 	// constraints
 	if ev.NodeCount < meta.Constraints.MinNodes || ev.NodeCount > meta.Constraints.MaxNodes {
@@ -0,0 +1,212 @@
+package leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/config"
+)
+
+// ---- types for meta config ----
+type LBConfig struct {
+	Version     int       `json:"version"`
+	Node        LBTypeCfg `json:"node"`
+	Daily       LBTypeCfg `json:"daily"`
+	Season      LBTypeCfg `json:"season"`
+	Constraints struct {
+		MinNodes int `json:"min_nodes"`
+		MaxNodes int `json:"max_nodes"`
+	} `json:"constraints"`
+}
+type LBTypeCfg struct {
+	IDTemplate string                 `json:"id_template"`
+	Sort       string                 `json:"sort"`
+	Operator   string                 `json:"operator"`
+	Reset      *string                `json:"reset"`
+	Metadata   map[string]interface{} `json:"metadata"`
+}
+
+// ---- config sources ----
+// the meta config is read from a file by default, the path can be changed
+// through runtime.env. Ops can also keep the config as a system owned
+// storage object and switch the source to storage.
+
+type lbConfigSource string
+
+const (
+	lbConfigSourceFile    = "file"
+	lbConfigSourceStorage = "storage"
+
+	lbConfigSourceEnv  = "LEADERBOARD_META_SOURCE"
+	lbConfigPathEnv    = "LEADERBOARD_META_PATH"
+	defaultLBMetaPath  = "modules/leaderboard/leaderboard_meta.json"
+	lbConfigCollection = "leaderboard_config"
+	lbConfigKey        = "meta"
+)
+
+func lbConfigPath(ctx context.Context) string {
+	return config.Env(ctx, lbConfigPathEnv, defaultLBMetaPath)
+}
+
+// reloadPath resolves a reload path, relative paths are taken from the
+// directory of the configured file. Only json files in that directory can
+// be loaded, the rpc must not read arbitrary files.
+func reloadPath(ctx context.Context, path string) (string, error) {
+	dir, err := filepath.Abs(filepath.Dir(lbConfigPath(ctx)))
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if filepath.Dir(path) != dir || filepath.Ext(path) != ".json" {
+		return "", fmt.Errorf("path must be a json file in %s", dir)
+	}
+	return path, nil
+}
+
+// ---- active meta config ----
+// the config is loaded in InitModule and can be swapped at runtime by the
+// reload rpc, readers always get a complete validated config
+var (
+	lbConfigMu sync.RWMutex
+	lbConfig   *LBConfig
+)
+
+func currentLBConfig() *LBConfig {
+	lbConfigMu.RLock()
+	defer lbConfigMu.RUnlock()
+	return lbConfig
+}
+
+func setLBConfig(cfg *LBConfig) {
+	lbConfigMu.Lock()
+	defer lbConfigMu.Unlock()
+	lbConfig = cfg
+}
+
+// ---- loading ----
+
+func loadLBConfigFrom(ctx context.Context, nk runtime.NakamaModule, source lbConfigSource, path string) (*LBConfig, error) {
+	switch source {
+	case lbConfigSourceFile:
+		return loadLBConfig(path)
+	case lbConfigSourceStorage:
+		return loadLBConfigFromStorage(ctx, nk)
+	default:
+		return nil, fmt.Errorf("unknown leaderboard config source %q", source)
+	}
+}
+
+func loadLBConfig(path string) (*LBConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseLBConfig(data)
+}
+
+func loadLBConfigFromStorage(ctx context.Context, nk runtime.NakamaModule) (*LBConfig, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: lbConfigCollection,
+		Key:        lbConfigKey,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("no leaderboard config stored under %s/%s", lbConfigCollection, lbConfigKey)
+	}
+	return parseLBConfig([]byte(objects[0].GetValue()))
+}
+
+// parseLBConfig migrates the raw config to the current version, decodes it
+// and validates it; nothing is returned unless the config is usable
+func parseLBConfig(data []byte) (*LBConfig, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if err := migrateLBConfig(raw); err != nil {
+		return nil, err
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var cfg LBConfig
+	if err := json.Unmarshal(migrated, &cfg); err != nil {
+		return nil, err
+	}
+	if err := validateLBConfig(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// ---- migrations ----
+// lbConfigMigrations[v] upgrades a raw config of version v to version v+1.
+// Configs without a version are treated as version 0.
+
+const currentLBConfigVersion = 1
+
+var lbConfigMigrations = map[int]func(raw map[string]interface{}) error{
+	0: migrateLBConfigV0,
+}
+
+func migrateLBConfig(raw map[string]interface{}) error {
+	version := 0
+	if v, ok := raw["version"]; ok {
+		f, ok := v.(float64)
+		if !ok || f != float64(int(f)) {
+			return fmt.Errorf("invalid config version %v", v)
+		}
+		version = int(f)
+	}
+	if version > currentLBConfigVersion {
+		return fmt.Errorf("config version %d is newer than the supported version %d", version, currentLBConfigVersion)
+	}
+
+	for version < currentLBConfigVersion {
+		migrate, ok := lbConfigMigrations[version]
+		if !ok {
+			return fmt.Errorf("no migration from config version %d", version)
+		}
+		if err := migrate(raw); err != nil {
+			return fmt.Errorf("migrating config from version %d: %w", version, err)
+		}
+		version++
+		raw["version"] = version
+	}
+	return nil
+}
+
+// version 0 configs kept min_nodes and max_nodes at the top level,
+// version 1 moved them under constraints
+func migrateLBConfigV0(raw map[string]interface{}) error {
+	constraints, _ := raw["constraints"].(map[string]interface{})
+	if constraints == nil {
+		if _, exists := raw["constraints"]; exists {
+			return errors.New("constraints must be an object")
+		}
+		constraints = map[string]interface{}{}
+	}
+	for _, k := range []string{"min_nodes", "max_nodes"} {
+		if v, ok := raw[k]; ok {
+			if _, set := constraints[k]; !set {
+				constraints[k] = v
+			}
+			delete(raw, k)
+		}
+	}
+	raw["constraints"] = constraints
+	return nil
+}
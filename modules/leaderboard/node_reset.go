@@ -0,0 +1,333 @@
+package leaderboard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// ---- node reset ----
+// what happens when a node leaderboard resets is driven by the node
+// metadata in the meta config:
+//
+//	"snapshot_standings": true,    archive the closing standings in storage
+//	"carry_over_percent": 10,      carry 10% of each best score into the new period
+//	"winner_points": [300, 200]    add 300/200 to the daily score of ranks 1 and 2
+//
+// The carried score is kept in the record metadata, the first improvement
+// on top of it forwards the whole new score to the daily board. Nakama only
+// writes to the current period, so winner points are credited to the daily
+// period that starts with the node reset: they count a day late, and the
+// points of a season's last day land after the season rollup and pay
+// nothing.
+
+type nodeResetConfig struct {
+	EventID            string  `json:"event_id"`
+	DailyLeaderboardID string  `json:"daily_leaderboard_id"`
+	SnapshotStandings  bool    `json:"snapshot_standings"`
+	CarryOverPercent   int64   `json:"carry_over_percent"`
+	WinnerPoints       []int64 `json:"winner_points"`
+}
+
+const (
+	snapshotCollection = "leaderboard_snapshots"
+
+	nodeResetStatusInProgress = "in_progress"
+	nodeResetStatusFailed     = "failed"
+	nodeResetStatusCompleted  = "completed"
+
+	nodeResetOpCarryOver = "carry_over"
+	nodeResetOpWinner    = "winner"
+)
+
+type snapshotRecord struct {
+	OwnerID  string `json:"owner_id"`
+	Username string `json:"username"`
+	Score    int64  `json:"score"`
+	Subscore int64  `json:"subscore"`
+	Rank     int64  `json:"rank"`
+}
+
+// one page of the closing standings, stored under <id>:<reset>:<page>
+type snapshotPage struct {
+	LeaderboardID string           `json:"leaderboard_id"`
+	Reset         int64            `json:"reset"`
+	Page          int              `json:"page"`
+	Records       []snapshotRecord `json:"records"`
+}
+
+// a carry-over or winner points write, kept when it fails so a resumed
+// reset retries it
+type nodeResetOp struct {
+	Kind     string `json:"kind"`
+	OwnerID  string `json:"owner_id"`
+	Username string `json:"username"`
+	Score    int64  `json:"score"`
+}
+
+// the summary stored under <id>:<reset> checkpoints the reset after every
+// page, a failed reset resumes at its cursor and retries its failed writes.
+// Only a reset without failures is completed, and a completed one is never
+// applied again.
+type nodeResetSummary struct {
+	LeaderboardID string `json:"leaderboard_id"`
+	Reset         int64  `json:"reset"`
+	Status        string `json:"status"`
+	Cursor        string `json:"cursor"`
+	Records       int    `json:"records"`
+	Pages         int    `json:"pages"`
+	CarriedOver   int    `json:"carried_over"`
+	WinnersFed    int    `json:"winners_fed"`
+	// Failed counts the writes still to retry, listed in FailedOps
+	Failed    int           `json:"failed"`
+	FailedOps []nodeResetOp `json:"failed_ops,omitempty"`
+	// FedWinners got their points on the daily leaderboard, which adds them
+	// up, so they're checkpointed one by one and never fed twice
+	FedWinners  []string `json:"fed_winners,omitempty"`
+	StartedAt   int64    `json:"started_at"`
+	UpdatedAt   int64    `json:"updated_at"`
+	CompletedAt int64    `json:"completed_at,omitempty"`
+}
+
+func parseNodeResetConfig(meta string) (*nodeResetConfig, error) {
+	var cfg nodeResetConfig
+	if strings.TrimSpace(meta) == "" {
+		return &cfg, nil
+	}
+	if err := json.Unmarshal([]byte(meta), &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func validateNodeResetConfig(cfg *nodeResetConfig) []string {
+	var errs []string
+	if cfg.CarryOverPercent < 0 || cfg.CarryOverPercent > 100 {
+		errs = append(errs, fmt.Sprintf("carry_over_percent must be between 0 and 100, got %d", cfg.CarryOverPercent))
+	}
+	for i, p := range cfg.WinnerPoints {
+		if p < 0 {
+			errs = append(errs, fmt.Sprintf("winner_points[%d] must not be negative", i))
+		}
+	}
+	return errs
+}
+
+func readNodeResetSummary(ctx context.Context, nk runtime.NakamaModule, nodeLbId string, reset int64) (*nodeResetSummary, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: snapshotCollection,
+		Key:        fmt.Sprintf("%s:%d", nodeLbId, reset),
+	}})
+	if err != nil || len(objects) == 0 {
+		return nil, err
+	}
+	var summary nodeResetSummary
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+func writeSnapshotObject(ctx context.Context, nk runtime.NakamaModule, key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      snapshotCollection,
+		Key:             key,
+		Value:           string(value),
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	return err
+}
+
+func writeNodeResetSummary(ctx context.Context, nk runtime.NakamaModule, summary *nodeResetSummary) error {
+	summary.UpdatedAt = time.Now().Unix()
+	return writeSnapshotObject(ctx, nk, fmt.Sprintf("%s:%d", summary.LeaderboardID, summary.Reset), summary)
+}
+
+func (s *nodeResetSummary) recordFailure(op nodeResetOp) {
+	s.FailedOps = append(s.FailedOps, op)
+	s.Failed = len(s.FailedOps)
+}
+
+// writeNodeResetOp writes a carry-over to the node board or winner points
+// to the daily board, a replay of the event log writes them the same way
+func writeNodeResetOp(ctx context.Context, nk runtime.NakamaModule, nodeLbId, dailyLbId string, op nodeResetOp) error {
+	var err error
+	switch op.Kind {
+	case nodeResetOpCarryOver:
+		_, err = nk.LeaderboardRecordWrite(ctx, nodeLbId, op.OwnerID, op.Username, op.Score, 0,
+			map[string]interface{}{"source_event": "node_reset_carry_over", "carried": op.Score}, nil)
+	case nodeResetOpWinner:
+		_, err = nk.LeaderboardRecordWrite(ctx, dailyLbId, op.OwnerID, op.Username, op.Score, 0,
+			map[string]interface{}{"source_event": "node_reset_winner", "node_leaderboard_id": nodeLbId}, nil)
+	default:
+		err = fmt.Errorf("unknown node reset op %q", op.Kind)
+	}
+	return err
+}
+
+// apply runs one carry-over or winner points write and appends it to the
+// event log
+func (s *nodeResetSummary) apply(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, cfg *nodeResetConfig, op nodeResetOp) error {
+	switch op.Kind {
+	case nodeResetOpCarryOver:
+		// the node board keeps the best score, writing it again is harmless
+		if err := writeNodeResetOp(ctx, nk, s.LeaderboardID, cfg.DailyLeaderboardID, op); err != nil {
+			return err
+		}
+		s.CarriedOver++
+		appendNodeResetLog(ctx, logger, db, nk, s, cfg, op)
+	case nodeResetOpWinner:
+		if slices.Contains(s.FedWinners, op.OwnerID) {
+			return nil
+		}
+		if err := writeNodeResetOp(ctx, nk, s.LeaderboardID, cfg.DailyLeaderboardID, op); err != nil {
+			return err
+		}
+		appendNodeResetLog(ctx, logger, db, nk, s, cfg, op)
+		s.WinnersFed++
+		s.FedWinners = append(s.FedWinners, op.OwnerID)
+		if err := writeNodeResetSummary(ctx, nk, s); err != nil {
+			return fmt.Errorf("failed to checkpoint the winner points of %s: %w", op.OwnerID, err)
+		}
+	}
+	return nil
+}
+
+func resetNodeLeaderboard(
+	ctx context.Context,
+	logger runtime.Logger,
+	db *sql.DB,
+	nk runtime.NakamaModule,
+	lb *api.Leaderboard,
+	reset int64,
+) (*nodeResetSummary, error) {
+	nodeLbId := lb.GetId()
+	cfg, err := parseNodeResetConfig(lb.GetMetadata())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse leaderboard metadata for id : %s: %w", nodeLbId, err)
+	}
+	if errs := validateNodeResetConfig(cfg); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid node reset config for id %s: %s", nodeLbId, strings.Join(errs, "; "))
+	}
+	if len(cfg.WinnerPoints) > 0 && cfg.DailyLeaderboardID == "" {
+		return nil, fmt.Errorf("node leaderboard %s has winner_points but no daily_leaderboard_id", nodeLbId)
+	}
+	if !cfg.SnapshotStandings && cfg.CarryOverPercent == 0 && len(cfg.WinnerPoints) == 0 {
+		logger.Debug("nothing configured for node leaderboard %s reset", nodeLbId)
+		return nil, nil
+	}
+
+	summary, err := readNodeResetSummary(ctx, nk, nodeLbId, reset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node reset summary for %s: %w", nodeLbId, err)
+	}
+	// a failed reset walked the whole board, only its failures are left
+	walked := false
+	switch {
+	case summary == nil:
+		summary = &nodeResetSummary{
+			LeaderboardID: nodeLbId,
+			Reset:         reset,
+			Status:        nodeResetStatusInProgress,
+			StartedAt:     time.Now().Unix(),
+		}
+	case summary.Status == nodeResetStatusCompleted:
+		logger.Info("node leaderboard %s already handled for reset %d", nodeLbId, reset)
+		return summary, nil
+	default:
+		logger.Info("resuming reset of node leaderboard %s for reset %d at cursor %q with %d failed writes",
+			nodeLbId, reset, summary.Cursor, summary.Failed)
+		walked = summary.Status == nodeResetStatusFailed
+		summary.Status = nodeResetStatusInProgress
+		failed := summary.FailedOps
+		summary.FailedOps = nil
+		summary.Failed = 0
+		for _, op := range failed {
+			if err := summary.apply(ctx, logger, db, nk, cfg, op); err != nil {
+				logger.Error(fmt.Sprintf("failed again to apply node reset %s for user id %v: %s", op.Kind, op.OwnerID, err))
+				summary.recordFailure(op)
+			}
+		}
+	}
+
+	for !walked {
+		records, _, nextCursor, _, err := nk.LeaderboardRecordsList(ctx, nodeLbId, nil, pageSize, summary.Cursor, reset)
+		if err != nil {
+			return summary, fmt.Errorf("error parsing through records (id=%s, cursor=%q): %w", nodeLbId, summary.Cursor, err)
+		}
+
+		// the page index comes from the checkpoint, a resumed page overwrites
+		// the same snapshot object
+		if cfg.SnapshotStandings && len(records) > 0 {
+			page := snapshotPage{LeaderboardID: nodeLbId, Reset: reset, Page: summary.Pages}
+			for _, r := range records {
+				page.Records = append(page.Records, snapshotRecord{
+					OwnerID:  r.GetOwnerId(),
+					Username: r.GetUsername().GetValue(),
+					Score:    r.GetScore(),
+					Subscore: r.GetSubscore(),
+					Rank:     r.GetRank(),
+				})
+			}
+			if err := writeSnapshotObject(ctx, nk, fmt.Sprintf("%s:%d:%d", nodeLbId, reset, summary.Pages), page); err != nil {
+				return summary, fmt.Errorf("failed to store snapshot page %d of %s: %w", summary.Pages, nodeLbId, err)
+			}
+			summary.Pages++
+		}
+
+		for _, r := range records {
+			summary.Records++
+
+			var ops []nodeResetOp
+			if carried := r.GetScore() * cfg.CarryOverPercent / 100; carried > 0 {
+				ops = append(ops, nodeResetOp{Kind: nodeResetOpCarryOver, OwnerID: r.GetOwnerId(), Username: r.GetUsername().GetValue(), Score: carried})
+			}
+			if rank := r.GetRank(); rank >= 1 && rank <= int64(len(cfg.WinnerPoints)) && cfg.WinnerPoints[rank-1] > 0 {
+				ops = append(ops, nodeResetOp{Kind: nodeResetOpWinner, OwnerID: r.GetOwnerId(), Username: r.GetUsername().GetValue(), Score: cfg.WinnerPoints[rank-1]})
+			}
+			for _, op := range ops {
+				if err := summary.apply(ctx, logger, db, nk, cfg, op); err != nil {
+					logger.Error(fmt.Sprintf("failed to apply node reset %s for user id %v: %s", op.Kind, op.OwnerID, err))
+					summary.recordFailure(op)
+				}
+			}
+		}
+
+		// checkpoint the page before moving on
+		summary.Cursor = nextCursor
+		if err := writeNodeResetSummary(ctx, nk, summary); err != nil {
+			return summary, fmt.Errorf("failed to checkpoint node reset of %s: %w", nodeLbId, err)
+		}
+		walked = nextCursor == ""
+	}
+
+	// the walk is done, failed writes keep the reset open for a resume
+	summary.Status = nodeResetStatusCompleted
+	if summary.Failed > 0 {
+		summary.Status = nodeResetStatusFailed
+	} else {
+		summary.CompletedAt = time.Now().Unix()
+	}
+	if err := writeNodeResetSummary(ctx, nk, summary); err != nil {
+		return summary, fmt.Errorf("failed to store node reset summary for %s: %w", nodeLbId, err)
+	}
+
+	logger.Info("node leaderboard %s reset handled: records=%d pages=%d carried_over=%d winners_fed=%d failed=%d",
+		nodeLbId, summary.Records, summary.Pages, summary.CarriedOver, summary.WinnersFed, summary.Failed)
+	if summary.Failed > 0 {
+		return summary, fmt.Errorf("%d node reset writes failed for %s, resume the reset to retry them", summary.Failed, nodeLbId)
+	}
+	return summary, nil
+}
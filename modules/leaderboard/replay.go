@@ -0,0 +1,158 @@
+package leaderboard
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	eventemitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+	"github.com/titan/titan-runtime/modules/utils"
+)
+
+// ---- replay ----
+// rebuilds the leaderboards of an event from the event log: the boards are
+// cleared and the root events of the time range are run through
+// HandleUpdateLeaderboardEvent again. Derived daily/season updates are
+// emitted as usual and applied asynchronously by the event processor. The
+// replayed events carry replay_id, so other subscribers (e.g. progression)
+// can tell them from new scores.
+//
+// Clearing drops every record of the boards, so apply always replays the
+// whole log, the time range only narrows a dry run. Node reset carry-overs
+// and winner points are logged as well and written again in log order. The
+// boards are rebuilt in the current reset period: daily deltas of past days
+// all land in today's daily board, the history of earlier periods is
+// flattened.
+
+const (
+	replayModeDryRun = "dry_run"
+	replayModeApply  = "apply"
+
+	replayIDProp = "replay_id"
+)
+
+type replayReport struct {
+	ReplayID     string         `json:"replay_id"`
+	EventID      string         `json:"event_id"`
+	Mode         string         `json:"mode"`
+	From         int64          `json:"from"`
+	To           int64          `json:"to"`
+	Leaderboards []string       `json:"leaderboards"`
+	Events       int            `json:"events"`
+	ByType       map[string]int `json:"by_type"`
+	FirstSeq     int64          `json:"first_seq,omitempty"`
+	LastSeq      int64          `json:"last_seq,omitempty"`
+	Applied      int            `json:"applied"`
+	Failed       int            `json:"failed"`
+}
+
+// leaderboardIDsForEvent expands the id templates the same way
+// createLeaderboardsForEvent does
+func leaderboardIDsForEvent(meta *LBConfig, ev *Event) (string, string, []string) {
+	vars := map[string]string{
+		"eventId":   ev.ID,
+		"nodeIndex": "",
+	}
+	seasonID := expandTemplate(meta.Season.IDTemplate, vars)
+	dailyID := expandTemplate(meta.Daily.IDTemplate, vars)
+
+	nodeIDs := make([]string, 0, ev.NodeCount)
+	for i := 1; i <= ev.NodeCount; i++ {
+		vars["nodeIndex"] = strconv.Itoa(i)
+		nodeIDs = append(nodeIDs, expandTemplate(meta.Node.IDTemplate, vars))
+	}
+	return seasonID, dailyID, nodeIDs
+}
+
+func replayLeaderboardEvents(
+	ctx context.Context,
+	logger runtime.Logger,
+	db *sql.DB,
+	nk runtime.NakamaModule,
+	eventID string,
+	from, to time.Time,
+	mode string,
+) (*replayReport, error) {
+	meta := currentLBConfig()
+	if mode == replayModeApply {
+		from, to = time.Unix(0, 0), time.Now()
+	}
+	ev, _, err := readEvent(ctx, nk, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	seasonID, dailyID, nodeIDs := leaderboardIDsForEvent(meta, ev)
+	report := &replayReport{
+		ReplayID:     utils.NewID(),
+		EventID:      eventID,
+		Mode:         mode,
+		From:         from.Unix(),
+		To:           to.Unix(),
+		Leaderboards: append([]string{seasonID, dailyID}, nodeIDs...),
+		ByType:       make(map[string]int),
+	}
+
+	events, err := listRootEvents(ctx, db, seasonID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the event log for %s: %w", eventID, err)
+	}
+	report.Events = len(events)
+	for _, e := range events {
+		report.ByType[e.Properties["leaderboard_type"]]++
+	}
+	if len(events) > 0 {
+		report.FirstSeq = events[0].Seq
+		report.LastSeq = events[len(events)-1].Seq
+	}
+	if mode != replayModeApply {
+		return report, nil
+	}
+
+	// clear the derived boards by re-creating them empty
+	logger.Warn("replay %s clearing leaderboards of event %s", report.ReplayID, eventID)
+	for _, id := range report.Leaderboards {
+		if err := nk.LeaderboardDelete(ctx, id); err != nil {
+			logger.Warn("failed to delete leaderboard %s before replay: %v", id, err)
+		}
+	}
+	if err := createLeaderboardsForEvent(ctx, logger, nk, meta, *ev); err != nil {
+		return report, fmt.Errorf("failed to re-create leaderboards for %s: %w", eventID, err)
+	}
+
+	for _, e := range events {
+		if op, ok := nodeResetOpFromLog(e.Properties); ok {
+			err := writeNodeResetOp(ctx, nk, e.Properties["node_leaderboard_id"], e.Properties["daily_leaderboard_id"], op)
+			if err != nil {
+				logger.Error("replay %s failed for logged node reset %s %d: %v", report.ReplayID, op.Kind, e.Seq, err)
+				report.Failed++
+				continue
+			}
+			report.Applied++
+			continue
+		}
+
+		props := stripEnvelope(e.Properties)
+		props[replayIDProp] = report.ReplayID
+		// a fresh envelope and idempotency key per replay, the derived events
+		// would otherwise be dropped as duplicates of the original ones
+		env := eventemitter.NewEnvelope(ctx)
+		env.IdempotencyKey = fmt.Sprintf("replay:%s:%d", report.ReplayID, e.Seq)
+		env.Apply(props)
+
+		evt := &api.Event{Name: "update_leaderboard", Properties: props}
+		if err := HandleUpdateLeaderboardEvent(eventemitter.WithEnvelope(ctx, env), logger, nk, evt); err != nil {
+			logger.Error("replay %s failed for logged event %d: %v", report.ReplayID, e.Seq, err)
+			report.Failed++
+			continue
+		}
+		report.Applied++
+	}
+
+	logger.Info("replay %s of event %s done: applied=%d failed=%d", report.ReplayID, eventID, report.Applied, report.Failed)
+	return report, nil
+}
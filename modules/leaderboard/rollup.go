@@ -0,0 +1,113 @@
+package leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// ---- daily to season rollup checkpoints ----
+// every rollup of a daily leaderboard period is tracked by one storage
+// object keyed by (daily leaderboard id, reset timestamp). The cursor is
+// saved after each page so a failed rollup resumes where it stopped, and
+// a completed rollup is never run twice. Owners whose season write failed
+// are kept and retried when the rollup is resumed, a rollup is only
+// completed once none is left.
+
+const (
+	rollupCollection = "leaderboard_rollups"
+
+	rollupStatusInProgress = "in_progress"
+	rollupStatusFailed     = "failed"
+	rollupStatusCompleted  = "completed"
+)
+
+type rollupState struct {
+	DailyLeaderboardID  string `json:"daily_leaderboard_id"`
+	SeasonLeaderboardID string `json:"season_leaderboard_id"`
+	Reset               int64  `json:"reset"`
+	Status              string `json:"status"`
+	Cursor              string `json:"cursor"`
+	Processed           int    `json:"processed"`
+	// Failed counts the owners still to retry, listed in FailedOwnerIDs
+	Failed         int      `json:"failed"`
+	FailedOwnerIDs []string `json:"failed_owner_ids,omitempty"`
+	StartedAt      int64    `json:"started_at"`
+	UpdatedAt      int64    `json:"updated_at"`
+	CompletedAt    int64    `json:"completed_at,omitempty"`
+}
+
+func rollupKey(dailyLbId string, reset int64) string {
+	return fmt.Sprintf("%s:%d", dailyLbId, reset)
+}
+
+func readRollupState(ctx context.Context, nk runtime.NakamaModule, dailyLbId string, reset int64) (*rollupState, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: rollupCollection,
+		Key:        rollupKey(dailyLbId, reset),
+	}})
+	if err != nil || len(objects) == 0 {
+		return nil, err
+	}
+	var state rollupState
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func writeRollupState(ctx context.Context, nk runtime.NakamaModule, state *rollupState) error {
+	state.UpdatedAt = time.Now().Unix()
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      rollupCollection,
+		Key:             rollupKey(state.DailyLeaderboardID, state.Reset),
+		Value:           string(value),
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	return err
+}
+
+// listRollupStates returns the rollups of a daily leaderboard, newest
+// reset last as stored
+func listRollupStates(ctx context.Context, nk runtime.NakamaModule, dailyLbId string) ([]*rollupState, error) {
+	var (
+		states []*rollupState
+		cursor string
+	)
+	prefix := dailyLbId + ":"
+	for {
+		objects, nextCursor, err := nk.StorageList(ctx, "", "", rollupCollection, pageSize, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("error listing rollups (cursor=%q): %w", cursor, err)
+		}
+		for _, o := range objects {
+			if !strings.HasPrefix(o.GetKey(), prefix) {
+				continue
+			}
+			var state rollupState
+			if err := json.Unmarshal([]byte(o.GetValue()), &state); err != nil {
+				return nil, fmt.Errorf("failed to parse rollup %s: %w", o.GetKey(), err)
+			}
+			states = append(states, &state)
+		}
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+	return states, nil
+}
+
+func (s *rollupState) recordFailure(ownerID string) {
+	s.FailedOwnerIDs = append(s.FailedOwnerIDs, ownerID)
+	s.Failed = len(s.FailedOwnerIDs)
+}
@@ -0,0 +1,43 @@
+package leaderboard
+
+import (
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/common/rpc"
+)
+
+// admin rpcs are only reachable server to server (http_key). Finalizing,
+// resuming and replaying walk whole leaderboards and run without deadline,
+// they can be resumed or retried when interrupted.
+func registerRPCs(initializer runtime.Initializer) error {
+	router := rpc.NewRouter(initializer).Use(rpc.ServerOnly)
+	timeout := rpc.Timeout(adminRPCTimeout)
+
+	if err := router.Register("create_leaderboard_event", CreateEventHandler, timeout); err != nil {
+		return err
+	}
+	if err := router.Register("update_leaderboard_event", UpdateEventHandler, timeout); err != nil {
+		return err
+	}
+	if err := router.Register("list_leaderboard_events", ListEventsHandler, timeout); err != nil {
+		return err
+	}
+	if err := router.Register("archive_leaderboard_event", ArchiveEventHandler, timeout); err != nil {
+		return err
+	}
+	if err := router.Register("reload_leaderboard_config", ReloadConfigHandler, timeout); err != nil {
+		return err
+	}
+	if err := router.Register("get_daily_rollup_status", RollupStatusHandler, timeout); err != nil {
+		return err
+	}
+	if err := router.Register("finalize_season", FinalizeSeasonHandler); err != nil {
+		return err
+	}
+	if err := router.Register("resume_daily_rollup", ResumeRollupHandler); err != nil {
+		return err
+	}
+	if err := router.Register("resume_node_reset", ResumeNodeResetHandler); err != nil {
+		return err
+	}
+	return router.Register("replay_leaderboard_events", ReplayEventsHandler)
+}
@@ -0,0 +1,371 @@
+package leaderboard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/config"
+	"github.com/titan/titan-runtime/modules/common/validation"
+	shared "github.com/titan/titan-runtime/shared"
+)
+
+type eventIDRequest struct {
+	ID string `json:"id" validate:"required"`
+}
+
+type listEventsRequest struct {
+	IncludeArchived bool `json:"include_archived"`
+}
+
+type listEventsResponse struct {
+	Events []*Event `json:"events"`
+}
+
+func eventCatalogError(logger runtime.Logger, err error) error {
+	switch {
+	case errors.Is(err, errInvalidEvent):
+		return runtime.NewError(err.Error(), shared.INVALID_ARGUMENT)
+	case errors.Is(err, errEventNotFound):
+		return runtime.NewError(err.Error(), shared.NOT_FOUND)
+	case errors.Is(err, errEventAlreadyExists):
+		return runtime.NewError(err.Error(), shared.ALREADY_EXISTS)
+	case errors.Is(err, errEventArchived):
+		return runtime.NewError(err.Error(), shared.FAILED_PRECONDITION)
+	default:
+		logger.Error("event catalog operation failed: %v", err)
+		return shared.ErrInternalError
+	}
+}
+
+func CreateEventHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var ev Event
+	if err := validation.Decode(payload, &ev); err != nil {
+		return "", err
+	}
+	if err := registerEvent(ctx, logger, db, nk, &ev); err != nil {
+		return "", eventCatalogError(logger, err)
+	}
+
+	responseJSON, err := json.Marshal(ev)
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
+
+func UpdateEventHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var ev Event
+	if err := validation.Decode(payload, &ev); err != nil {
+		return "", err
+	}
+	if err := updateEvent(ctx, logger, db, nk, &ev); err != nil {
+		return "", eventCatalogError(logger, err)
+	}
+
+	responseJSON, err := json.Marshal(ev)
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
+
+func ListEventsHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req listEventsRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return "", err
+	}
+	events, err := listEvents(ctx, nk, req.IncludeArchived)
+	if err != nil {
+		return "", eventCatalogError(logger, err)
+	}
+
+	responseJSON, err := json.Marshal(listEventsResponse{Events: events})
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
+
+func ArchiveEventHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req eventIDRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return "", err
+	}
+	ev, err := archiveEvent(ctx, logger, nk, req.ID)
+	if err != nil {
+		return "", eventCatalogError(logger, err)
+	}
+
+	responseJSON, err := json.Marshal(ev)
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
+
+type reloadConfigRequest struct {
+	// Source is "file" or "storage", defaults to the source set in runtime.env
+	Source string `json:"source" validate:"oneof=file storage"`
+	// Path overrides the configured file path when Source is "file", it
+	// must name a json file next to the configured one
+	Path string `json:"path"`
+}
+
+type reloadConfigResponse struct {
+	Version int    `json:"version"`
+	Source  string `json:"source"`
+}
+
+// ReloadConfigHandler swaps the active meta config without restarting Nakama.
+// The new config only replaces the old one once it passed validation, and
+// it applies to leaderboards provisioned from then on.
+func ReloadConfigHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req reloadConfigRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return "", err
+	}
+	if req.Source == "" {
+		req.Source = config.Env(ctx, lbConfigSourceEnv, lbConfigSourceFile)
+	}
+	if req.Path == "" {
+		req.Path = lbConfigPath(ctx)
+	} else {
+		path, err := reloadPath(ctx, req.Path)
+		if err != nil {
+			return "", validation.ToRuntimeError(validation.Errors{{Field: "path", Rule: "path", Message: err.Error()}})
+		}
+		req.Path = path
+	}
+
+	meta, err := loadLBConfigFrom(ctx, nk, lbConfigSource(req.Source), req.Path)
+	if err != nil {
+		logger.Error("failed to reload leaderboard config from %s: %v", req.Source, err)
+		return "", runtime.NewError(err.Error(), shared.FAILED_PRECONDITION)
+	}
+	setLBConfig(meta)
+	logger.Info("leaderboard config version %d reloaded from %s", meta.Version, req.Source)
+
+	responseJSON, err := json.Marshal(reloadConfigResponse{Version: meta.Version, Source: req.Source})
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
+
+type finalizeSeasonRequest struct {
+	LeaderboardID string `json:"leaderboard_id" validate:"required"`
+	// Reset is the reset timestamp of the standings to pay, 0 pays the
+	// current standings of a season that never resets
+	Reset int64 `json:"reset" validate:"min=0"`
+}
+
+// FinalizeSeasonHandler runs (or retries) a season finalization by hand,
+// users that were already paid for the same reset are skipped
+func FinalizeSeasonHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req finalizeSeasonRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return "", err
+	}
+
+	lb, err := getSeasonLeaderboard(ctx, nk, req.LeaderboardID)
+	if err != nil {
+		if errors.Is(err, errSeasonNotFound) {
+			return "", runtime.NewError(err.Error(), shared.NOT_FOUND)
+		}
+		logger.Error("failed to get season leaderboard %s: %v", req.LeaderboardID, err)
+		return "", shared.ErrInternalError
+	}
+
+	state, err := finalizeSeason(ctx, logger, nk, lb, req.Reset)
+	if err != nil && state == nil {
+		logger.Error("failed to finalize season %s: %v", req.LeaderboardID, err)
+		return "", shared.ErrInternalError
+	}
+
+	responseJSON, err := json.Marshal(state)
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
+
+type rollupRequest struct {
+	DailyLeaderboardID string `json:"daily_leaderboard_id" validate:"required"`
+	// Reset selects a single rollup, all rollups of the board are listed
+	// by the status rpc when it's 0
+	Reset int64 `json:"reset" validate:"min=0"`
+}
+
+type rollupStatusResponse struct {
+	Rollups []*rollupState `json:"rollups"`
+}
+
+// RollupStatusHandler reports the processed/failed counts of daily rollups
+func RollupStatusHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req rollupRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return "", err
+	}
+
+	var resp rollupStatusResponse
+	if req.Reset != 0 {
+		state, err := readRollupState(ctx, nk, req.DailyLeaderboardID, req.Reset)
+		if err != nil {
+			logger.Error("failed to read rollup of %s: %v", req.DailyLeaderboardID, err)
+			return "", shared.ErrInternalError
+		}
+		if state == nil {
+			return "", runtime.NewError("rollup not found", shared.NOT_FOUND)
+		}
+		resp.Rollups = []*rollupState{state}
+	} else {
+		states, err := listRollupStates(ctx, nk, req.DailyLeaderboardID)
+		if err != nil {
+			logger.Error("failed to list rollups of %s: %v", req.DailyLeaderboardID, err)
+			return "", shared.ErrInternalError
+		}
+		resp.Rollups = states
+	}
+
+	responseJSON, err := json.Marshal(resp)
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
+
+// ResumeRollupHandler continues a failed daily rollup from its checkpoint,
+// completed rollups are left untouched
+func ResumeRollupHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req rollupRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return "", err
+	}
+	if req.Reset == 0 {
+		return "", shared.NewStructuredError("invalid request", shared.INVALID_ARGUMENT, []shared.FieldError{
+			{Field: "reset", Rule: "required", Message: "is required"},
+		})
+	}
+
+	lbs, err := nk.LeaderboardsGetId(ctx, []string{req.DailyLeaderboardID})
+	if err != nil {
+		logger.Error("failed to get daily leaderboard %s: %v", req.DailyLeaderboardID, err)
+		return "", shared.ErrInternalError
+	}
+	if len(lbs) == 0 {
+		return "", runtime.NewError("daily leaderboard not found", shared.NOT_FOUND)
+	}
+
+	state, err := runDailyRollup(ctx, logger, db, nk, lbs[0], req.Reset)
+	if err != nil {
+		logger.Error("failed to resume rollup of %s: %v", req.DailyLeaderboardID, err)
+		if state == nil {
+			return "", runtime.NewError(err.Error(), shared.FAILED_PRECONDITION)
+		}
+		return "", runtime.NewError(err.Error(), shared.UNAVAILABLE)
+	}
+
+	responseJSON, err := json.Marshal(state)
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
+
+type nodeResetRequest struct {
+	NodeLeaderboardID string `json:"node_leaderboard_id" validate:"required"`
+	Reset             int64  `json:"reset" validate:"required"`
+}
+
+// ResumeNodeResetHandler continues a failed node reset from its checkpoint
+// and retries its failed writes, completed resets are left untouched
+func ResumeNodeResetHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req nodeResetRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return "", err
+	}
+
+	lbs, err := nk.LeaderboardsGetId(ctx, []string{req.NodeLeaderboardID})
+	if err != nil {
+		logger.Error("failed to get node leaderboard %s: %v", req.NodeLeaderboardID, err)
+		return "", shared.ErrInternalError
+	}
+	if len(lbs) == 0 {
+		return "", runtime.NewError("node leaderboard not found", shared.NOT_FOUND)
+	}
+
+	summary, err := resetNodeLeaderboard(ctx, logger, db, nk, lbs[0], req.Reset)
+	if err != nil {
+		logger.Error("failed to resume reset of %s: %v", req.NodeLeaderboardID, err)
+		if summary == nil {
+			return "", runtime.NewError(err.Error(), shared.FAILED_PRECONDITION)
+		}
+		return "", runtime.NewError(err.Error(), shared.UNAVAILABLE)
+	}
+	if summary == nil {
+		summary = &nodeResetSummary{LeaderboardID: req.NodeLeaderboardID, Reset: req.Reset, Status: nodeResetStatusCompleted}
+	}
+
+	responseJSON, err := json.Marshal(summary)
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
+
+type replayRequest struct {
+	EventID string `json:"event_id" validate:"required"`
+	// From and To bound the emit time of the replayed events of a dry run
+	// in unix seconds, To defaults to now. Apply replays the whole log and
+	// takes neither.
+	From int64  `json:"from" validate:"min=0"`
+	To   int64  `json:"to" validate:"min=0"`
+	Mode string `json:"mode" validate:"oneof=dry_run apply"`
+}
+
+// ReplayEventsHandler rebuilds the leaderboards of an event from the event
+// log. The default dry_run mode only reports what an apply would do, apply
+// always replays the whole log of the event.
+func ReplayEventsHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var req replayRequest
+	if err := validation.Decode(payload, &req); err != nil {
+		return "", err
+	}
+	if req.Mode == "" {
+		req.Mode = replayModeDryRun
+	}
+	if req.Mode == replayModeApply && (req.From != 0 || req.To != 0) {
+		return "", validation.ToRuntimeError(validation.Errors{{
+			Field:   "from",
+			Rule:    "apply",
+			Message: "from and to only narrow a dry_run, apply replays the whole event log",
+		}})
+	}
+	to := time.Now()
+	if req.To > 0 {
+		to = time.Unix(req.To, 0)
+	}
+	from := time.Unix(req.From, 0)
+	if !from.Before(to) {
+		return "", runtime.NewError("from must be before to", shared.INVALID_ARGUMENT)
+	}
+
+	report, err := replayLeaderboardEvents(ctx, logger, db, nk, req.EventID, from, to, req.Mode)
+	if err != nil {
+		if report == nil {
+			return "", eventCatalogError(logger, err)
+		}
+		logger.Error("replay of event %s failed: %v", req.EventID, err)
+		return "", shared.ErrInternalError
+	}
+
+	responseJSON, err := json.Marshal(report)
+	if err != nil {
+		return "", shared.ErrInternalError
+	}
+	return string(responseJSON), nil
+}
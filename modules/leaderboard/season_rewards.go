@@ -0,0 +1,481 @@
+package leaderboard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	eventProcessor "github.com/titan/titan-runtime/modules/common/eventProcessor"
+	"github.com/titan/titan-runtime/modules/common/notifier"
+	"github.com/titan/titan-runtime/modules/common/scheduler"
+	"github.com/titan/titan-runtime/modules/common/services"
+)
+
+// ---- season reward brackets ----
+// brackets are declared under "rewards" in the season metadata, e.g.
+//
+//	"rewards": [
+//	  {"min_rank": 1, "max_rank": 1, "changeset": {"diamonds": 1000}},
+//	  {"min_rank": 2, "max_rank": 10, "changeset": {"coins": 500}}
+//	]
+
+type rewardBracket struct {
+	MinRank   int64            `json:"min_rank"`
+	MaxRank   int64            `json:"max_rank"`
+	Changeset map[string]int64 `json:"changeset"`
+}
+
+type seasonMetadata struct {
+	EventID     string          `json:"event_id"`
+	SeasonEndTs int64           `json:"season_end_ts"`
+	Rewards     []rewardBracket `json:"rewards"`
+}
+
+// the state of one season finalization, keyed by leaderboard id and reset
+type seasonFinalization struct {
+	LeaderboardID string `json:"leaderboard_id"`
+	Reset         int64  `json:"reset"`
+	Status        string `json:"status"`
+	Paid          int    `json:"paid"`
+	AlreadyPaid   int    `json:"already_paid"`
+	Failed        int    `json:"failed"`
+	CompletedAt   int64  `json:"completed_at,omitempty"`
+}
+
+// the per-user payout record, written in the same transaction as the wallet
+// update so it doubles as the idempotency marker
+type seasonPayout struct {
+	LeaderboardID string           `json:"leaderboard_id"`
+	Reset         int64            `json:"reset"`
+	Rank          int64            `json:"rank"`
+	Score         int64            `json:"score"`
+	Changeset     map[string]int64 `json:"changeset"`
+	PaidAt        int64            `json:"paid_at"`
+	// NotifiedAt is set once the reward notification went out, a payout
+	// without it is notified again by the next finalization run
+	NotifiedAt int64 `json:"notified_at,omitempty"`
+}
+
+const (
+	seasonFinalizationCollection = "season_finalizations"
+	seasonPayoutCollection       = "season_payouts"
+
+	// emitted by the schedule created for every event at its season_end_ts
+	finalizeSeasonEvent = "finalize_season"
+
+	finalizationStatusCompleted = "completed"
+	finalizationStatusPartial   = "partial"
+)
+
+func parseSeasonMetadata(data []byte) (*seasonMetadata, error) {
+	var meta seasonMetadata
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return &meta, nil
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func validateRewardBrackets(brackets []rewardBracket) []string {
+	var errs []string
+
+	sorted := make([]rewardBracket, len(brackets))
+	copy(sorted, brackets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MinRank < sorted[j].MinRank })
+
+	for i, b := range sorted {
+		if b.MinRank < 1 || b.MaxRank < b.MinRank {
+			errs = append(errs, fmt.Sprintf("invalid reward bracket ranks %d-%d", b.MinRank, b.MaxRank))
+		}
+		if i > 0 && b.MinRank <= sorted[i-1].MaxRank {
+			errs = append(errs, fmt.Sprintf("reward bracket %d-%d overlaps %d-%d",
+				b.MinRank, b.MaxRank, sorted[i-1].MinRank, sorted[i-1].MaxRank))
+		}
+		if len(b.Changeset) == 0 {
+			errs = append(errs, fmt.Sprintf("reward bracket %d-%d has no changeset", b.MinRank, b.MaxRank))
+		}
+		for currency, amount := range b.Changeset {
+			if amount <= 0 {
+				errs = append(errs, fmt.Sprintf("reward bracket %d-%d pays non positive %s", b.MinRank, b.MaxRank, currency))
+			}
+		}
+	}
+	return errs
+}
+
+func bracketForRank(brackets []rewardBracket, rank int64) *rewardBracket {
+	for i := range brackets {
+		if rank >= brackets[i].MinRank && rank <= brackets[i].MaxRank {
+			return &brackets[i]
+		}
+	}
+	return nil
+}
+
+func maxRewardedRank(brackets []rewardBracket) int64 {
+	var max int64
+	for _, b := range brackets {
+		if b.MaxRank > max {
+			max = b.MaxRank
+		}
+	}
+	return max
+}
+
+func finalizationKey(leaderboardID string, reset int64) string {
+	return fmt.Sprintf("%s:%d", leaderboardID, reset)
+}
+
+func readSeasonFinalization(ctx context.Context, nk runtime.NakamaModule, leaderboardID string, reset int64) (*seasonFinalization, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: seasonFinalizationCollection,
+		Key:        finalizationKey(leaderboardID, reset),
+	}})
+	if err != nil || len(objects) == 0 {
+		return nil, err
+	}
+	var f seasonFinalization
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func writeSeasonFinalization(ctx context.Context, nk runtime.NakamaModule, f *seasonFinalization) error {
+	value, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      seasonFinalizationCollection,
+		Key:             finalizationKey(f.LeaderboardID, f.Reset),
+		Value:           string(value),
+		PermissionRead:  runtime.STORAGE_PERMISSION_NO_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	return err
+}
+
+func payoutExists(ctx context.Context, nk runtime.NakamaModule, userID, key string) (bool, error) {
+	payout, _, err := readSeasonPayout(ctx, nk, userID, key)
+	return payout != nil, err
+}
+
+// readSeasonPayout returns the payout record of userID and its version, nil
+// when the user wasn't paid
+func readSeasonPayout(ctx context.Context, nk runtime.NakamaModule, userID, key string) (*seasonPayout, string, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: seasonPayoutCollection,
+		Key:        key,
+		UserID:     userID,
+	}})
+	if err != nil || len(objects) == 0 {
+		return nil, "", err
+	}
+	var payout seasonPayout
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &payout); err != nil {
+		return nil, "", err
+	}
+	return &payout, objects[0].GetVersion(), nil
+}
+
+// finalizeSeason pays the reward brackets for the standings that closed at
+// reset. Every payout is written together with its payout record, and the
+// record is only created if it doesn't exist yet, so running it again for
+// the same (leaderboard, reset) never pays anyone twice. The notification
+// is marked on the record once sent, a run that fails to notify stays
+// partial and the next run notifies the users that weren't.
+func finalizeSeason(
+	ctx context.Context,
+	logger runtime.Logger,
+	nk runtime.NakamaModule,
+	lb *api.Leaderboard,
+	reset int64,
+) (*seasonFinalization, error) {
+	seasonLbId := lb.GetId()
+	meta, err := parseSeasonMetadata([]byte(lb.GetMetadata()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse season metadata for id %s: %w", seasonLbId, err)
+	}
+	if len(meta.Rewards) == 0 {
+		logger.Info("season leaderboard %s has no reward brackets; nothing to pay", seasonLbId)
+		return &seasonFinalization{LeaderboardID: seasonLbId, Reset: reset, Status: finalizationStatusCompleted}, nil
+	}
+
+	existing, err := readSeasonFinalization(ctx, nk, seasonLbId, reset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read finalization state for %s: %w", seasonLbId, err)
+	}
+	if existing != nil && existing.Status == finalizationStatusCompleted {
+		logger.Info("season leaderboard %s already finalized for reset %d", seasonLbId, reset)
+		return existing, nil
+	}
+
+	state := &seasonFinalization{LeaderboardID: seasonLbId, Reset: reset}
+	payoutKey := finalizationKey(seasonLbId, reset)
+	lastRank := maxRewardedRank(meta.Rewards)
+
+	var cursor string
+PAGES:
+	for {
+		records, _, nextCursor, _, err := nk.LeaderboardRecordsList(ctx, seasonLbId, nil, pageSize, cursor, reset)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing through records (id=%s, cursor=%q): %w", seasonLbId, cursor, err)
+		}
+
+		for _, r := range records {
+			// records come in rank order, nobody further down gets a reward
+			if r.GetRank() > lastRank {
+				break PAGES
+			}
+			bracket := bracketForRank(meta.Rewards, r.GetRank())
+			if bracket == nil {
+				continue
+			}
+
+			paid, err := paySeasonReward(ctx, logger, nk, r, bracket, payoutKey, reset)
+			switch {
+			case err != nil:
+				state.Failed++
+				logger.Error(fmt.Sprintf("failed to pay season reward to user id %v: %s", r.GetOwnerId(), err))
+				continue
+			case paid:
+				state.Paid++
+			default:
+				state.AlreadyPaid++
+			}
+			if err := notifySeasonReward(ctx, logger, nk, r.GetOwnerId(), payoutKey); err != nil {
+				state.Failed++
+				logger.Error(fmt.Sprintf("failed to notify season reward to user id %v: %s", r.GetOwnerId(), err))
+			}
+		}
+
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+
+	state.Status = finalizationStatusCompleted
+	if state.Failed > 0 {
+		state.Status = finalizationStatusPartial
+	} else {
+		state.CompletedAt = time.Now().Unix()
+	}
+	if err := writeSeasonFinalization(ctx, nk, state); err != nil {
+		return nil, fmt.Errorf("failed to store finalization state for %s: %w", seasonLbId, err)
+	}
+
+	logger.Info("season leaderboard %s finalized for reset %d: paid=%d already_paid=%d failed=%d",
+		seasonLbId, reset, state.Paid, state.AlreadyPaid, state.Failed)
+	if state.Failed > 0 {
+		return state, fmt.Errorf("%d season payouts failed for %s, finalize again to retry them", state.Failed, seasonLbId)
+	}
+	return state, nil
+}
+
+// paySeasonReward reports false when the user was already paid for this reset
+func paySeasonReward(
+	ctx context.Context,
+	logger runtime.Logger,
+	nk runtime.NakamaModule,
+	r *api.LeaderboardRecord,
+	bracket *rewardBracket,
+	payoutKey string,
+	reset int64,
+) (bool, error) {
+	userID := r.GetOwnerId()
+	payout := seasonPayout{
+		LeaderboardID: r.GetLeaderboardId(),
+		Reset:         reset,
+		Rank:          r.GetRank(),
+		Score:         r.GetScore(),
+		Changeset:     bracket.Changeset,
+		PaidAt:        time.Now().Unix(),
+	}
+	value, err := json.Marshal(payout)
+	if err != nil {
+		return false, err
+	}
+
+	record := &runtime.StorageWrite{
+		Collection:      seasonPayoutCollection,
+		Key:             payoutKey,
+		UserID:          userID,
+		Value:           string(value),
+		Version:         "*",
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}
+	ledgerMetadata := map[string]interface{}{
+		"reason":         "season_reward",
+		"leaderboard_id": payout.LeaderboardID,
+		"reset":          reset,
+		"rank":           payout.Rank,
+	}
+
+	if _, _, err := services.WalletUpdateWithRecord(ctx, nk, logger, userID, bracket.Changeset, ledgerMetadata, record); err != nil {
+		// the record write is conditional, a conflict means an earlier run paid
+		if exists, readErr := payoutExists(ctx, nk, userID, payoutKey); readErr == nil && exists {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// notifySeasonReward sends the reward notification of a payout that wasn't
+// notified yet and marks the payout record. A failed mark sends it again on
+// the next run, the notification is delivered at least once.
+func notifySeasonReward(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID, payoutKey string) error {
+	payout, version, err := readSeasonPayout(ctx, nk, userID, payoutKey)
+	if err != nil {
+		return err
+	}
+	if payout == nil || payout.NotifiedAt > 0 {
+		return nil
+	}
+
+	vars := notifier.Vars{
+		"leaderboard_id": payout.LeaderboardID,
+		"rank":           payout.Rank,
+		"score":          payout.Score,
+		"rewards":        payout.Changeset,
+	}
+	if err := notifier.Notify(ctx, nk, logger, seasonRewardNotificationCode, notifier.Recipients{Self: userID}, vars); err != nil {
+		return err
+	}
+
+	payout.NotifiedAt = time.Now().Unix()
+	value, err := json.Marshal(payout)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      seasonPayoutCollection,
+		Key:             payoutKey,
+		UserID:          userID,
+		Value:           string(value),
+		Version:         version,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}})
+	return err
+}
+
+// ---- scheduled finalization ----
+// the season board never resets, so nothing else closes it: every event
+// gets a one-off schedule at its season_end_ts emitting finalize_season,
+// which pays the standings out like a finalize_season rpc with reset 0
+
+// scheduleSeasonFinalization schedules the payout of ev's season at its
+// end and sets FinalizeScheduleID
+func scheduleSeasonFinalization(ctx context.Context, db *sql.DB, ev *Event) error {
+	s := &scheduler.Schedule{
+		EventName:  finalizeSeasonEvent,
+		Properties: map[string]string{"event_id": ev.ID},
+		DueAt:      time.Unix(ev.SeasonEndTs, 0).UTC(),
+	}
+	if err := scheduler.Create(ctx, db, s); err != nil {
+		return fmt.Errorf("failed to schedule the season payout of %s: %w", ev.ID, err)
+	}
+	ev.FinalizeScheduleID = s.ID
+	return nil
+}
+
+// cancelSeasonFinalization drops a schedule that was replaced, one that
+// already fired is left alone
+func cancelSeasonFinalization(ctx context.Context, logger runtime.Logger, db *sql.DB, scheduleID string) {
+	if scheduleID == "" {
+		return
+	}
+	if err := scheduler.Cancel(ctx, db, scheduleID); err != nil && !errors.Is(err, scheduler.ErrNotPending) {
+		logger.Warn("failed to cancel season payout schedule %s: %v", scheduleID, err)
+	}
+}
+
+// scheduleMissingFinalizations schedules the payout of catalog events
+// stored before payouts were scheduled
+func scheduleMissingFinalizations(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, events []*Event) {
+	for _, ev := range events {
+		if ev.FinalizeScheduleID != "" {
+			continue
+		}
+		_, version, err := readEvent(ctx, nk, ev.ID)
+		if err == nil {
+			err = scheduleSeasonFinalization(ctx, db, ev)
+		}
+		if err == nil {
+			if err = writeEvent(ctx, nk, ev, version); err != nil {
+				cancelSeasonFinalization(ctx, logger, db, ev.FinalizeScheduleID)
+			}
+		}
+		if err != nil {
+			logger.Error("failed to schedule the season payout of event %s: %v", ev.ID, err)
+			continue
+		}
+		logger.Info("scheduled the season payout of event %s at %d", ev.ID, ev.SeasonEndTs)
+	}
+}
+
+// HandleFinalizeSeasonEvent pays out the season of an event once it ended.
+// Failed payouts fail the delivery, so they're retried and dead-lettered
+// like any event.
+func HandleFinalizeSeasonEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) error {
+	eventID := evt.GetProperties()["event_id"]
+	ev, _, err := readEvent(ctx, nk, eventID)
+	if errors.Is(err, errEventNotFound) {
+		logger.Warn("season payout scheduled for unknown event %s", eventID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// a schedule replaced by a later season_end_ts may still fire
+	if time.Now().Unix() < ev.SeasonEndTs {
+		logger.Info("season of event %s ends at %d; skipping early payout", eventID, ev.SeasonEndTs)
+		return nil
+	}
+
+	seasonID, _, _ := leaderboardIDsForEvent(currentLBConfig(), ev)
+	lb, err := getSeasonLeaderboard(ctx, nk, seasonID)
+	if err != nil {
+		if errors.Is(err, errSeasonNotFound) {
+			return eventProcessor.Permanent(err)
+		}
+		return err
+	}
+	// a season board with a reset schedule is finalized by its resets
+	if lb.GetNextReset() > 0 {
+		logger.Info("season leaderboard %s resets; leaving the payout to its reset", seasonID)
+		return nil
+	}
+	_, err = finalizeSeason(ctx, logger, nk, lb, 0)
+	return err
+}
+
+var errSeasonNotFound = errors.New("season leaderboard not found")
+
+func getSeasonLeaderboard(ctx context.Context, nk runtime.NakamaModule, leaderboardID string) (*api.Leaderboard, error) {
+	lbs, err := nk.LeaderboardsGetId(ctx, []string{leaderboardID})
+	if err != nil {
+		return nil, err
+	}
+	if len(lbs) == 0 {
+		return nil, errSeasonNotFound
+	}
+	meta, _ := parseLeaderboardMetadataValues(lbs[0].GetMetadata())
+	if t, _ := meta["leaderboard_type"].(string); t != "season" {
+		return nil, errSeasonNotFound
+	}
+	return lbs[0], nil
+}
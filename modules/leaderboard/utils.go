@@ -48,6 +48,24 @@ func getCurrentScore(
 	leaderboardId string,
 	userId string,
 ) int64 {
+	record, err := getCurrentRecord(ctx, nk, leaderboardId, userId)
+	if err != nil {
+		logger.Error("Failed to fetch current leaderboard record")
+		return 0
+	}
+	if record == nil {
+		return 0
+	}
+	return record.Score
+}
+
+// getCurrentRecord returns the record of userId, nil when there's none
+func getCurrentRecord(
+	ctx context.Context,
+	nk runtime.NakamaModule,
+	leaderboardId string,
+	userId string,
+) (*api.LeaderboardRecord, error) {
 	_, userRecords, _, _, err := nk.LeaderboardRecordsList(
 		ctx,
 		leaderboardId,
@@ -56,15 +74,13 @@ func getCurrentScore(
 		"",
 		0,
 	)
-
 	if err != nil {
-		logger.Error("Failed to fetch current leaderboard record")
-		return 0
+		return nil, err
 	}
-	if userRecords == nil || len(userRecords) == 0 {
-		return 0
+	if len(userRecords) == 0 {
+		return nil, nil
 	}
-	return userRecords[0].Score
+	return userRecords[0], nil
 }
 
 func parseLeaderboardMetadata(meta string) (map[string]string, error) {
@@ -77,3 +93,16 @@ func parseLeaderboardMetadata(meta string) (map[string]string, error) {
 	}
 	return m, nil
 }
+
+// parseLeaderboardMetadataValues keeps non string values, node and season
+// metadata carry numbers such as node_index and season_end_ts
+func parseLeaderboardMetadataValues(meta string) (map[string]interface{}, error) {
+	if strings.TrimSpace(meta) == "" {
+		return nil, nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(meta), &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
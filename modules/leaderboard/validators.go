@@ -3,135 +3,164 @@ package leaderboard
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/modules/common/cron"
 )
 
-// TO DO : Integrate a good rule base validator, refer the below article
-// For data structures that are being imported from external libraries like here
-// redefine the data structure with struct validate tags
-// https://dev.to/kittipat1413/a-guide-to-input-validation-in-go-with-validator-v10-56bp
-
-func validateGenericLeaderboardEventInputs(evt *api.Event) error {
-	var errs []string
+func validateDailyLeaderboardResetInputs(
+	ctx context.Context,
+	db *sql.DB,
+	nk runtime.NakamaModule,
+	lb *api.Leaderboard,
+) error {
 
-	if evt.Name == "" {
-		errs = append(errs, "id is required")
-	}
-	if evt.Properties == nil || len(evt.Properties) == 0 {
-		errs = append(errs, "Properties map cannot be empty")
+	dailyLbId := lb.GetId()
+	metaData, err := parseLeaderboardMetadata(lb.GetMetadata())
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to parse leaderboard metadata for id : %s", dailyLbId)
+		return errors.New(errMsg)
 	}
 
-	props := evt.GetProperties()
-	leaderboardType, ok := props["leaderboard_type"]
-	if !ok {
-		errs = append(errs, "leaderboard_type key must be present")
+	associatedSeasonLbId, ok := metaData["season_leaderboard_id"]
+	if !ok || associatedSeasonLbId == "" {
+		errMsg := "an associated season leaderboard id for the daily leaderboard id" +
+			"must be present in leaderboard metadata"
+		return errors.New(errMsg)
 	}
-	if ok {
-		switch leaderboardType {
-		case "node", "daily", "season":
-			// valid
-		default:
-			errs = append(errs, fmt.Sprintf("invalid leaderboard_type: %q", leaderboardType))
-		}
+
+	lbExists, err := checkLeaderboardExists(ctx, nk, lb)
+	if !lbExists || err != nil {
+		errMsg := fmt.Sprintf("leaderboard with id %s doesn't exist", dailyLbId) + err.Error()
+		return errors.New(errMsg)
 	}
+	return nil
+}
+
+// template variables createLeaderboardsForEvent expands
+var lbTemplateVars = map[string]bool{
+	"eventId":   true,
+	"nodeIndex": true,
+}
+
+var templateVarPattern = regexp.MustCompile(`\$\{([^}]*)\}`)
 
-	nodeLbId := props["node_leaderboard_id"]
-	scoreStr := props["score"]
-	userId := props["user_id"]
-	userName := props["user_name"]
-	dailyLbId := props["daily_leaderboard_id"]
-	seasonLbId := props["season_leaderboard_id"]
+func validateLBConfig(cfg *LBConfig) error {
+	var errs []string
 
-	if nodeLbId == "" {
-		errs = append(errs, "missing node_leaderboard_id")
+	if cfg.Version != currentLBConfigVersion {
+		errs = append(errs, fmt.Sprintf("unsupported version %d", cfg.Version))
 	}
-	if scoreStr == "" {
-		errs = append(errs, "missing score")
+
+	sections := []struct {
+		name string
+		cfg  LBTypeCfg
+	}{
+		{"node", cfg.Node},
+		{"daily", cfg.Daily},
+		{"season", cfg.Season},
 	}
-	if userId == "" {
-		errs = append(errs, "missing user_id")
+	ids := make(map[string]string)
+	for _, s := range sections {
+		for _, e := range validateLBTypeCfg(s.name, s.cfg) {
+			errs = append(errs, s.name+": "+e)
+		}
+		if other, ok := ids[s.cfg.IDTemplate]; ok && s.cfg.IDTemplate != "" {
+			errs = append(errs, fmt.Sprintf("%s: id_template collides with %s", s.name, other))
+		}
+		ids[s.cfg.IDTemplate] = s.name
 	}
-	if userName == "" {
-		errs = append(errs, "missing user_name")
+
+	// node ids must differ per node, the others are one per event
+	if !strings.Contains(cfg.Node.IDTemplate, "${nodeIndex}") {
+		errs = append(errs, "node: id_template must reference ${nodeIndex}")
 	}
-	if dailyLbId == "" {
-		errs = append(errs, "missing daily_leaderboard_id")
+	for _, s := range sections[1:] {
+		if strings.Contains(s.cfg.IDTemplate, "${nodeIndex}") {
+			errs = append(errs, s.name+": id_template must not reference ${nodeIndex}")
+		}
 	}
-	if seasonLbId == "" {
-		errs = append(errs, "missing season_leaderboard_id")
+
+	if data, err := json.Marshal(cfg.Node.Metadata); err != nil {
+		errs = append(errs, fmt.Sprintf("node: invalid metadata: %v", err))
+	} else if nodeCfg, err := parseNodeResetConfig(string(data)); err != nil {
+		errs = append(errs, fmt.Sprintf("node: invalid metadata: %v", err))
+	} else {
+		for _, e := range validateNodeResetConfig(nodeCfg) {
+			errs = append(errs, "node: "+e)
+		}
 	}
 
-	if scoreStr != "" {
-		if _, err := parseScore(scoreStr); err != nil {
-			errs = append(errs, fmt.Sprintf("invalid score value %q: %v", scoreStr, err))
+	if rewards, ok := cfg.Season.Metadata["rewards"]; ok {
+		data, _ := json.Marshal(map[string]interface{}{"rewards": rewards})
+		if meta, err := parseSeasonMetadata(data); err != nil {
+			errs = append(errs, fmt.Sprintf("season: invalid metadata.rewards: %v", err))
+		} else {
+			for _, e := range validateRewardBrackets(meta.Rewards) {
+				errs = append(errs, "season: "+e)
+			}
 		}
 	}
 
-	if len(errs) > 0 {
-		return errors.New(strings.Join(errs, "; "))
+	if cfg.Constraints.MinNodes < 1 {
+		errs = append(errs, "constraints: min_nodes must be at least 1")
+	}
+	if cfg.Constraints.MinNodes > cfg.Constraints.MaxNodes {
+		errs = append(errs, fmt.Sprintf("constraints: min_nodes (%d) must not exceed max_nodes (%d)",
+			cfg.Constraints.MinNodes, cfg.Constraints.MaxNodes))
 	}
-	return nil
-}
 
-func validateNodeLeaderboardEventInputs(evt *api.Event) error {
-	// all the validation are done in GenericLeaderboardEventInputs
-	// any custom ones to be added here in future
+	if len(errs) > 0 {
+		return errors.New("invalid leaderboard config: " + strings.Join(errs, "; "))
+	}
 	return nil
 }
 
-func validateDailyLeaderboardEventInputs(evt *api.Event) error {
+func validateLBTypeCfg(lbType string, cfg LBTypeCfg) []string {
 	var errs []string
 
-	props := evt.GetProperties()
-	deltaStr := props["delta"]
-
-	_, err := parseScore(deltaStr)
-	if err != nil {
-		errs = append(errs, "Invalid delta value for daily leaderboard event")
+	if strings.TrimSpace(cfg.IDTemplate) == "" {
+		errs = append(errs, "id_template is required")
 	}
-
-	if len(errs) > 0 {
-		return errors.New(strings.Join(errs, "; "))
+	if !strings.Contains(cfg.IDTemplate, "${eventId}") {
+		errs = append(errs, "id_template must reference ${eventId}")
+	}
+	for _, m := range templateVarPattern.FindAllStringSubmatch(cfg.IDTemplate, -1) {
+		if !lbTemplateVars[m[1]] {
+			errs = append(errs, fmt.Sprintf("id_template references unknown variable %q", m[1]))
+		}
 	}
-	return nil
-}
-
-func validateSeasonLeaderboardEventInputs(evt *api.Event) error {
-	// all the validation are done in GenericLeaderboardEventInputs
-	// any custom ones to be added here in future
-	return nil
-}
 
-func validateDailyLeaderboardResetInputs(
-	ctx context.Context,
-	db *sql.DB,
-	nk runtime.NakamaModule,
-	lb *api.Leaderboard,
-) error {
+	switch cfg.Sort {
+	case "asc", "desc":
+		// valid
+	default:
+		errs = append(errs, fmt.Sprintf("invalid sort: %q", cfg.Sort))
+	}
 
-	dailyLbId := lb.GetId()
-	metaData, err := parseLeaderboardMetadata(lb.GetMetadata())
-	if err != nil {
-		errMsg := fmt.Sprintf("failed to parse leaderboard metadata for id : %s", dailyLbId)
-		return errors.New(errMsg)
+	switch cfg.Operator {
+	case "best", "set", "incr", "decr":
+		// valid
+	default:
+		errs = append(errs, fmt.Sprintf("invalid operator: %q", cfg.Operator))
 	}
 
-	associatedSeasonLbId, ok := metaData["season_leaderboard_id"]
-	if !ok || associatedSeasonLbId == "" {
-		errMsg := "an associated season leaderboard id for the daily leaderboard id" +
-			"must be present in leaderboard metadata"
-		return errors.New(errMsg)
+	if reset := stringOrEmpty(cfg.Reset); reset != "" {
+		if _, err := cron.Parse(reset); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid reset schedule %q: %v", reset, err))
+		}
 	}
 
-	lbExists, err := checkLeaderboardExists(ctx, nk, lb)
-	if !lbExists || err != nil {
-		errMsg := fmt.Sprintf("leaderboard with id %s doesn't exist", dailyLbId) + err.Error()
-		return errors.New(errMsg)
+	// the reset handler routes on this key
+	if t, _ := cfg.Metadata["leaderboard_type"].(string); t != lbType {
+		errs = append(errs, fmt.Sprintf("metadata.leaderboard_type must be %q", lbType))
 	}
-	return nil
+
+	return errs
 }
@@ -0,0 +1,140 @@
+package progression
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ---- progression config ----
+// the level curve lists the total xp each level needs, with the wallet
+// rewards paid when reaching it. XP sources say how much xp an action is
+// worth: XP + PerUnit * units (e.g. score points), capped at Max when set.
+
+const (
+	configPathEnv     = "PROGRESSION_CONFIG_PATH"
+	defaultConfigPath = "modules/progression/progression.json"
+
+	sourceLeaderboardImprovement = "leaderboard_improvement"
+	sourceDailyLogin             = "daily_login"
+
+	// set by the leaderboard on the events of a replay
+	replayIDProp = "replay_id"
+)
+
+type Config struct {
+	Levels  []LevelConfig       `json:"levels"`
+	Sources map[string]XPSource `json:"sources"`
+}
+
+type LevelConfig struct {
+	Level   int              `json:"level"`
+	XP      int64            `json:"xp"`
+	Rewards map[string]int64 `json:"rewards,omitempty"`
+}
+
+type XPSource struct {
+	XP      int64   `json:"xp"`
+	PerUnit float64 `json:"per_unit"`
+	Max     int64   `json:"max"`
+}
+
+// amount is the xp earned for units of the source
+func (s XPSource) amount(units int64) int64 {
+	xp := s.XP + int64(math.Floor(s.PerUnit*float64(units)))
+	if s.Max > 0 && xp > s.Max {
+		xp = s.Max
+	}
+	if xp < 0 {
+		return 0
+	}
+	return xp
+}
+
+// levelFor returns the highest level reached with xp
+func (c *Config) levelFor(xp int64) int {
+	level := c.Levels[0].Level
+	for _, l := range c.Levels {
+		if xp < l.XP {
+			break
+		}
+		level = l.Level
+	}
+	return level
+}
+
+// level returns the config of level, nil past the last level
+func (c *Config) level(level int) *LevelConfig {
+	i := level - c.Levels[0].Level
+	if i < 0 || i >= len(c.Levels) {
+		return nil
+	}
+	return &c.Levels[i]
+}
+
+func (c *Config) validate() error {
+	var errs []string
+	if len(c.Levels) == 0 {
+		errs = append(errs, "at least one level is required")
+	}
+	for i, l := range c.Levels {
+		switch {
+		case i == 0 && (l.Level != 1 || l.XP != 0):
+			errs = append(errs, "the first level must be level 1 at 0 xp")
+		case i > 0 && l.Level != c.Levels[i-1].Level+1:
+			errs = append(errs, fmt.Sprintf("level %d follows level %d, levels must be consecutive", l.Level, c.Levels[i-1].Level))
+		case i > 0 && l.XP <= c.Levels[i-1].XP:
+			errs = append(errs, fmt.Sprintf("level %d needs %d xp, more than level %d is required", l.Level, l.XP, c.Levels[i-1].Level))
+		}
+		for currency, amount := range l.Rewards {
+			if amount <= 0 {
+				errs = append(errs, fmt.Sprintf("level %d reward %s must be positive", l.Level, currency))
+			}
+		}
+	}
+	for name, s := range c.Sources {
+		if s.XP < 0 || s.PerUnit < 0 || s.Max < 0 {
+			errs = append(errs, fmt.Sprintf("xp source %s must not be negative", name))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid progression config %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid progression config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+var (
+	configMu sync.RWMutex
+	cfg      *Config
+)
+
+func currentConfig() *Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return cfg
+}
+
+func setConfig(c *Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	cfg = c
+}
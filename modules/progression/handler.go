@@ -0,0 +1,98 @@
+package progression
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+	"github.com/titan/titan-runtime/modules/common/models"
+	"github.com/titan/titan-runtime/modules/utils"
+)
+
+// HandleLeaderboardUpdateEvent grants xp for node leaderboard improvements,
+// they're forwarded to the daily leaderboard with the improvement as delta.
+// Events re-emitted by a leaderboard replay were already paid for.
+func HandleLeaderboardUpdateEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) error {
+	props := evt.GetProperties()
+	if props["leaderboard_type"] != "daily" || props[replayIDProp] != "" {
+		return nil
+	}
+	source, ok := currentConfig().Sources[sourceLeaderboardImprovement]
+	if !ok {
+		return nil
+	}
+	delta, err := parseInt(props["delta"])
+	if err != nil || delta <= 0 {
+		return nil
+	}
+
+	_, err = updateProgression(ctx, logger, nk, props["user_id"], sourceLeaderboardImprovement, eventKey(ctx, evt), grantXP(source.amount(delta)))
+	return err
+}
+
+// HandleLoginEvent grants the daily login xp
+func HandleLoginEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) error {
+	source, ok := currentConfig().Sources[sourceDailyLogin]
+	if !ok {
+		return nil
+	}
+	userID := evt.GetProperties()["user_id"]
+	if userID == "" {
+		return nil
+	}
+
+	_, err := updateProgression(ctx, logger, nk, userID, sourceDailyLogin, eventKey(ctx, evt), grantLoginXP(source.amount(0), time.Now()))
+	return err
+}
+
+// eventKey is the idempotency key of the event being handled
+func eventKey(ctx context.Context, evt *api.Event) string {
+	if env, ok := eventEmitter.EnvelopeFromContext(ctx); ok {
+		return env.IdempotencyKey
+	}
+	if env, ok := eventEmitter.EnvelopeFromEvent(evt); ok {
+		return env.IdempotencyKey
+	}
+	return ""
+}
+
+type getProgressionRequest struct{}
+
+type progressionResponse struct {
+	Level      int   `json:"level"`
+	Experience int64 `json:"experience"`
+	// LevelXP and NextLevelXP are the total xp of the current and next
+	// level, NextLevelXP is 0 at the last level
+	LevelXP        int64                `json:"level_xp"`
+	NextLevelXP    int64                `json:"next_level_xp"`
+	MaxLevel       bool                 `json:"max_level"`
+	PendingRewards []models.LevelReward `json:"pending_rewards,omitempty"`
+}
+
+// GetProgressionHandler returns the caller's progression, pending rewards
+// are paid on the way
+func GetProgressionHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *getProgressionRequest) (*progressionResponse, error) {
+	p, err := updateProgression(ctx, logger, nk, utils.UserID(ctx), "", "", grantXP(0))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := currentConfig()
+	resp := &progressionResponse{
+		Level:          p.Level,
+		Experience:     p.Experience,
+		PendingRewards: p.PendingRewards,
+	}
+	if l := cfg.level(p.Level); l != nil {
+		resp.LevelXP = l.XP
+	}
+	if next := cfg.level(p.Level + 1); next != nil {
+		resp.NextLevelXP = next.XP
+	} else {
+		resp.MaxLevel = true
+	}
+	return resp, nil
+}
@@ -0,0 +1,43 @@
+package progression
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/config"
+	eventProcessor "github.com/titan/titan-runtime/modules/common/eventProcessor"
+	"github.com/titan/titan-runtime/modules/common/rpc"
+)
+
+const rpcTimeout = 5 * time.Second
+
+func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	logger.Info("Initializing Progression domain...")
+	cfg, err := loadConfig(config.Env(ctx, configPathEnv, defaultConfigPath))
+	if err != nil {
+		return err
+	}
+	setConfig(cfg)
+
+	router := rpc.NewRouter(initializer)
+	if err := rpc.Register(router, "get_progression", GetProgressionHandler, rpc.RequireAuth, rpc.Timeout(rpcTimeout)); err != nil {
+		return err
+	}
+
+	if err := eventProcessor.Subscribe("update_leaderboard", "progression", HandleLeaderboardUpdateEvent); err != nil {
+		return err
+	}
+	if err := eventProcessor.Subscribe("account_logged_in", "progression", HandleLoginEvent); err != nil {
+		return err
+	}
+
+	logger.Info("Progression domain initialized with %d levels", len(cfg.Levels))
+	return nil
+}
+
+func parseInt(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
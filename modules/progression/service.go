@@ -0,0 +1,140 @@
+package progression
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+	"github.com/titan/titan-runtime/modules/common/models"
+	"github.com/titan/titan-runtime/modules/common/services"
+)
+
+// mutation changes the progression before xp is granted and returns the xp
+// to grant, and whether the progression changed at all
+type mutation func(p *models.Progression) (xp int64, changed bool)
+
+const (
+	// requeue attempts when putting back rewards that couldn't be paid
+	requeueAttempts = 3
+	// idempotency keys kept in the progression to drop redelivered events
+	maxRecentEvents = 64
+)
+
+// updateProgression applies mutate to the progression of userID. The write
+// is version checked, a concurrent update fails it and the event is
+// retried. Level-up rewards, and any still pending, are taken out of the
+// state by that same write, paid afterwards and put back when the payment
+// fails, so a reward is never paid twice. eventKey is the idempotency key
+// of the event granting the xp, an event already applied is skipped.
+func updateProgression(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID, source, eventKey string, mutate mutation) (*models.Progression, error) {
+	cfg := currentConfig()
+	p, version, err := services.GetProgression(ctx, nk, logger, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read progression of %s: %w", userID, err)
+	}
+	if eventKey != "" && slices.Contains(p.RecentEvents, eventKey) {
+		logger.Debug("%s xp of event %s was already granted to %s", source, eventKey, userID)
+		return p, nil
+	}
+
+	xp, changed := mutate(p)
+	if !changed && xp <= 0 && len(p.PendingRewards) == 0 {
+		return p, nil
+	}
+	if eventKey != "" {
+		p.RecentEvents = append(p.RecentEvents, eventKey)
+		if n := len(p.RecentEvents); n > maxRecentEvents {
+			p.RecentEvents = p.RecentEvents[n-maxRecentEvents:]
+		}
+	}
+
+	previousLevel := p.Level
+	p.Experience += xp
+	p.Level = cfg.levelFor(p.Experience)
+	due := p.PendingRewards
+	for level := previousLevel + 1; level <= p.Level; level++ {
+		if l := cfg.level(level); l != nil && len(l.Rewards) > 0 {
+			due = append(due, models.LevelReward{Level: level, Changeset: l.Rewards})
+		}
+	}
+	p.PendingRewards = nil
+	p.UpdatedAt = time.Now().Unix()
+
+	if _, err := services.WriteProgression(ctx, nk, logger, userID, p, version); err != nil {
+		return nil, fmt.Errorf("failed to write progression of %s: %w", userID, err)
+	}
+	if xp > 0 {
+		logger.Debug("granted %d %s xp to %s", xp, source, userID)
+	}
+
+	if p.Level > previousLevel {
+		logger.Info("%s reached level %d", userID, p.Level)
+		if err := eventEmitter.EmitEvent(ctx, nk, "level_up", map[string]string{
+			"user_id":        userID,
+			"level":          strconv.Itoa(p.Level),
+			"previous_level": strconv.Itoa(previousLevel),
+			"experience":     strconv.FormatInt(p.Experience, 10),
+			"source":         source,
+		}); err != nil {
+			logger.Error("failed to emit level_up event for %s: %v", userID, err)
+		}
+	}
+
+	if unpaid := payRewards(ctx, logger, nk, userID, due); len(unpaid) > 0 {
+		p.PendingRewards = requeueRewards(ctx, logger, nk, userID, unpaid)
+	}
+	return p, nil
+}
+
+// payRewards pays rewards and returns the ones that failed
+func payRewards(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, rewards []models.LevelReward) []models.LevelReward {
+	var unpaid []models.LevelReward
+	for _, r := range rewards {
+		metadata := map[string]interface{}{"reason": "level_up", "level": r.Level}
+		if _, _, err := services.WalletUpdate(ctx, nk, logger, userID, r.Changeset, metadata, true); err != nil {
+			logger.Error("failed to pay level %d reward to %s: %v", r.Level, userID, err)
+			unpaid = append(unpaid, r)
+		}
+	}
+	return unpaid
+}
+
+// requeueRewards puts unpaid rewards back into the progression and returns
+// the pending rewards stored
+func requeueRewards(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, unpaid []models.LevelReward) []models.LevelReward {
+	for attempt := 1; attempt <= requeueAttempts; attempt++ {
+		p, version, err := services.GetProgression(ctx, nk, logger, userID)
+		if err == nil {
+			p.PendingRewards = append(p.PendingRewards, unpaid...)
+			if _, err = services.WriteProgression(ctx, nk, logger, userID, p, version); err == nil {
+				return p.PendingRewards
+			}
+		}
+		logger.Warn("failed to requeue rewards of %s (attempt %d/%d): %v", userID, attempt, requeueAttempts, err)
+	}
+	logger.WithField("rewards", unpaid).Error("level rewards of %s are lost, they need to be paid by hand", userID)
+	return unpaid
+}
+
+// grantXP grants a fixed amount of xp
+func grantXP(xp int64) mutation {
+	return func(p *models.Progression) (int64, bool) {
+		return xp, false
+	}
+}
+
+// grantLoginXP grants the daily login xp once per UTC day
+func grantLoginXP(xp int64, now time.Time) mutation {
+	return func(p *models.Progression) (int64, bool) {
+		day := now.UTC().Format(time.DateOnly)
+		if p.LastLoginDay == day {
+			return 0, false
+		}
+		p.LastLoginDay = day
+		return xp, true
+	}
+}
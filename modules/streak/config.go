@@ -0,0 +1,156 @@
+package streak
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/titan/titan-runtime/modules/common/models"
+)
+
+// ---- login calendar config ----
+// the calendar has 7 or 28 days, a login on streak day n is rewarded with
+// calendar day n. Past the last day the calendar starts over when Repeat is
+// set, otherwise the last day is rewarded for as long as the streak lasts.
+// Freezes are earned every EarnEvery streak days, up to Max, and each one
+// covers a missed day. A gap the freezes can't cover resets the streak.
+
+type Config struct {
+	Days    []DayConfig  `json:"days"`
+	Repeat  bool         `json:"repeat"`
+	Freezes FreezeConfig `json:"freezes"`
+}
+
+type DayConfig struct {
+	Day     int              `json:"day"`
+	Rewards map[string]int64 `json:"rewards"`
+}
+
+type FreezeConfig struct {
+	Max       int `json:"max"`
+	EarnEvery int `json:"earn_every"`
+}
+
+// calendarDay is the calendar day rewarded on streak day streak
+func (c *Config) calendarDay(streak int) int {
+	n := len(c.Days)
+	switch {
+	case streak <= 0:
+		return 0
+	case c.Repeat:
+		return (streak-1)%n + 1
+	case streak > n:
+		return n
+	}
+	return streak
+}
+
+// loginResult is what a login changed in the streak
+type loginResult struct {
+	// counted is false when the day was already counted
+	counted bool
+	frozen  int
+	// reset is set when the login broke a streak of previous days
+	reset        bool
+	previous     int
+	earnedFreeze bool
+	reward       DayConfig
+}
+
+// applyLogin counts a login on today, the local date as midnight UTC
+func (c *Config) applyLogin(s *models.LoginStreak, today time.Time) loginResult {
+	var r loginResult
+	if last, err := time.Parse(time.DateOnly, s.LastLoginDay); err == nil {
+		gap := int(today.Sub(last).Hours() / 24)
+		if gap <= 0 {
+			// already counted, or the timezone moved west of the last login
+			return r
+		}
+		switch missed := gap - 1; {
+		case missed == 0:
+		case missed <= s.Freezes:
+			s.Freezes -= missed
+			s.FreezesUsed += missed
+			r.frozen = missed
+		default:
+			r.reset = true
+			r.previous = s.Streak
+			s.Streak = 0
+		}
+	}
+
+	r.counted = true
+	s.Streak++
+	s.TotalLogins++
+	s.LastLoginDay = today.Format(time.DateOnly)
+	if s.Streak > s.Best {
+		s.Best = s.Streak
+	}
+	if c.Freezes.EarnEvery > 0 && s.Streak%c.Freezes.EarnEvery == 0 && s.Freezes < c.Freezes.Max {
+		s.Freezes++
+		r.earnedFreeze = true
+	}
+	s.CalendarDay = c.calendarDay(s.Streak)
+	r.reward = c.Days[s.CalendarDay-1]
+	return r
+}
+
+func (c *Config) validate() error {
+	var errs []string
+	if n := len(c.Days); n != 7 && n != 28 {
+		errs = append(errs, fmt.Sprintf("the calendar has %d days, 7 or 28 are supported", n))
+	}
+	for i, d := range c.Days {
+		if d.Day != i+1 {
+			errs = append(errs, fmt.Sprintf("day %d is listed as day %d, days must be in order from 1", i+1, d.Day))
+		}
+		for currency, amount := range d.Rewards {
+			if amount <= 0 {
+				errs = append(errs, fmt.Sprintf("day %d reward %s must be positive", d.Day, currency))
+			}
+		}
+	}
+	if c.Freezes.Max < 0 || c.Freezes.EarnEvery < 0 {
+		errs = append(errs, "freezes must not be negative")
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid login calendar config %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid login calendar config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+var (
+	configMu sync.RWMutex
+	cfg      *Config
+)
+
+func currentConfig() *Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return cfg
+}
+
+func setConfig(c *Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	cfg = c
+}
@@ -0,0 +1,163 @@
+package streak
+
+import (
+	"testing"
+	"time"
+
+	"github.com/titan/titan-runtime/modules/common/models"
+)
+
+func testConfig(repeat bool) *Config {
+	c := &Config{Repeat: repeat, Freezes: FreezeConfig{Max: 2, EarnEvery: 3}}
+	for i := 1; i <= 7; i++ {
+		c.Days = append(c.Days, DayConfig{Day: i, Rewards: map[string]int64{"coins": int64(i * 10)}})
+	}
+	return c
+}
+
+func TestApplyLogin(t *testing.T) {
+	day := func(s string) time.Time {
+		v, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name   string
+		repeat bool
+		before models.LoginStreak
+		today  string
+		want   loginResult
+		after  models.LoginStreak
+	}{
+		{
+			name:   "first login",
+			before: models.LoginStreak{},
+			today:  "2025-03-10",
+			want:   loginResult{counted: true, reward: DayConfig{Day: 1}},
+			after:  models.LoginStreak{Streak: 1, Best: 1, CalendarDay: 1, LastLoginDay: "2025-03-10", TotalLogins: 1},
+		},
+		{
+			name:   "same day",
+			before: models.LoginStreak{Streak: 2, Best: 2, CalendarDay: 2, LastLoginDay: "2025-03-10", TotalLogins: 2},
+			today:  "2025-03-10",
+			want:   loginResult{},
+			after:  models.LoginStreak{Streak: 2, Best: 2, CalendarDay: 2, LastLoginDay: "2025-03-10", TotalLogins: 2},
+		},
+		{
+			name:   "timezone moved west",
+			before: models.LoginStreak{Streak: 2, Best: 2, CalendarDay: 2, LastLoginDay: "2025-03-10", TotalLogins: 2},
+			today:  "2025-03-09",
+			want:   loginResult{},
+			after:  models.LoginStreak{Streak: 2, Best: 2, CalendarDay: 2, LastLoginDay: "2025-03-10", TotalLogins: 2},
+		},
+		{
+			name:   "next day",
+			before: models.LoginStreak{Streak: 1, Best: 1, CalendarDay: 1, LastLoginDay: "2025-03-10", TotalLogins: 1},
+			today:  "2025-03-11",
+			want:   loginResult{counted: true, reward: DayConfig{Day: 2}},
+			after:  models.LoginStreak{Streak: 2, Best: 2, CalendarDay: 2, LastLoginDay: "2025-03-11", TotalLogins: 2},
+		},
+		{
+			name:   "missed day covered by a freeze",
+			before: models.LoginStreak{Streak: 4, Best: 4, CalendarDay: 4, LastLoginDay: "2025-03-10", Freezes: 1, TotalLogins: 4},
+			today:  "2025-03-12",
+			want:   loginResult{counted: true, frozen: 1, reward: DayConfig{Day: 5}},
+			after:  models.LoginStreak{Streak: 5, Best: 5, CalendarDay: 5, LastLoginDay: "2025-03-12", FreezesUsed: 1, TotalLogins: 5},
+		},
+		{
+			name:   "missed days covered by freezes",
+			before: models.LoginStreak{Streak: 4, Best: 4, CalendarDay: 4, LastLoginDay: "2025-03-10", Freezes: 2, TotalLogins: 4},
+			today:  "2025-03-13",
+			want:   loginResult{counted: true, frozen: 2, reward: DayConfig{Day: 5}},
+			after:  models.LoginStreak{Streak: 5, Best: 5, CalendarDay: 5, LastLoginDay: "2025-03-13", FreezesUsed: 2, TotalLogins: 5},
+		},
+		{
+			name:   "more missed days than freezes",
+			before: models.LoginStreak{Streak: 4, Best: 6, CalendarDay: 4, LastLoginDay: "2025-03-10", Freezes: 1, TotalLogins: 9},
+			today:  "2025-03-13",
+			want:   loginResult{counted: true, reset: true, previous: 4, reward: DayConfig{Day: 1}},
+			after:  models.LoginStreak{Streak: 1, Best: 6, CalendarDay: 1, LastLoginDay: "2025-03-13", Freezes: 1, TotalLogins: 10},
+		},
+		{
+			name:   "missed day without freezes",
+			before: models.LoginStreak{Streak: 2, Best: 2, CalendarDay: 2, LastLoginDay: "2025-03-10", TotalLogins: 2},
+			today:  "2025-03-12",
+			want:   loginResult{counted: true, reset: true, previous: 2, reward: DayConfig{Day: 1}},
+			after:  models.LoginStreak{Streak: 1, Best: 2, CalendarDay: 1, LastLoginDay: "2025-03-12", TotalLogins: 3},
+		},
+		{
+			name:   "earns a freeze",
+			before: models.LoginStreak{Streak: 2, Best: 2, CalendarDay: 2, LastLoginDay: "2025-03-10", TotalLogins: 2},
+			today:  "2025-03-11",
+			want:   loginResult{counted: true, earnedFreeze: true, reward: DayConfig{Day: 3}},
+			after:  models.LoginStreak{Streak: 3, Best: 3, CalendarDay: 3, LastLoginDay: "2025-03-11", Freezes: 1, TotalLogins: 3},
+		},
+		{
+			name:   "freezes capped at max",
+			before: models.LoginStreak{Streak: 5, Best: 5, CalendarDay: 5, LastLoginDay: "2025-03-10", Freezes: 2, TotalLogins: 5},
+			today:  "2025-03-11",
+			want:   loginResult{counted: true, reward: DayConfig{Day: 6}},
+			after:  models.LoginStreak{Streak: 6, Best: 6, CalendarDay: 6, LastLoginDay: "2025-03-11", Freezes: 2, TotalLogins: 6},
+		},
+		{
+			name:   "last day past the calendar",
+			before: models.LoginStreak{Streak: 7, Best: 7, CalendarDay: 7, LastLoginDay: "2025-03-10", Freezes: 2, TotalLogins: 7},
+			today:  "2025-03-11",
+			want:   loginResult{counted: true, reward: DayConfig{Day: 7}},
+			after:  models.LoginStreak{Streak: 8, Best: 8, CalendarDay: 7, LastLoginDay: "2025-03-11", Freezes: 2, TotalLogins: 8},
+		},
+		{
+			name:   "repeating calendar starts over",
+			repeat: true,
+			before: models.LoginStreak{Streak: 7, Best: 7, CalendarDay: 7, LastLoginDay: "2025-03-10", Freezes: 2, TotalLogins: 7},
+			today:  "2025-03-11",
+			want:   loginResult{counted: true, reward: DayConfig{Day: 1}},
+			after:  models.LoginStreak{Streak: 8, Best: 8, CalendarDay: 1, LastLoginDay: "2025-03-11", Freezes: 2, TotalLogins: 8},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.before
+			got := testConfig(tt.repeat).applyLogin(&s, day(tt.today))
+			if got.counted != tt.want.counted || got.frozen != tt.want.frozen || got.reset != tt.want.reset ||
+				got.previous != tt.want.previous || got.earnedFreeze != tt.want.earnedFreeze || got.reward.Day != tt.want.reward.Day {
+				t.Fatalf("applyLogin() = %+v, want %+v", got, tt.want)
+			}
+			if s != tt.after {
+				t.Fatalf("streak = %+v, want %+v", s, tt.after)
+			}
+		})
+	}
+}
+
+func TestLocalDay(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2025, 3, 10, 2, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		loc  *time.Location
+		want string
+	}{
+		{name: "utc", loc: time.UTC, want: "2025-03-10"},
+		{name: "west of utc", loc: newYork, want: "2025-03-09"},
+		{name: "east of utc", loc: tokyo, want: "2025-03-10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := localDay(at, tt.loc).Format(time.DateOnly); got != tt.want {
+				t.Fatalf("localDay(%s, %s) = %s, want %s", at, tt.loc, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package streak
+
+import (
+	"time"
+
+	"github.com/titan/titan-runtime/modules/common/notifier"
+)
+
+const (
+	configPathEnv     = "STREAK_CONFIG_PATH"
+	defaultConfigPath = "modules/streak/streak.json"
+
+	streakCollection = "login_streak"
+	streakKey        = "state"
+
+	rpcTimeout = 5 * time.Second
+)
+
+// notification codes sent by the streak domain
+const (
+	loginRewardNotificationCode notifier.NotificationMessage = 110
+)
+
+var notificationTemplates = map[notifier.NotificationMessage]notifier.Template{
+	loginRewardNotificationCode: {
+		Subject:    "Login reward",
+		Body:       "Day {{.calendar_day}} of your login calendar, {{.streak}} day in a row",
+		BodyPlural: "Day {{.calendar_day}} of your login calendar, {{.streak}} days in a row",
+		Count:      "streak",
+		Audience:   notifier.AudienceSelf,
+	},
+}
@@ -0,0 +1,115 @@
+package streak
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+	"github.com/titan/titan-runtime/modules/utils"
+)
+
+// HandleLoginEvent counts the login on the day it happened, which may not
+// be today when the event was delayed or retried
+func HandleLoginEvent(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, evt *api.Event) error {
+	userID := evt.GetProperties()["user_id"]
+	if userID == "" {
+		return nil
+	}
+	at := time.Now()
+	if env, ok := eventEmitter.EnvelopeFromEvent(evt); ok && !env.EmittedAt.IsZero() {
+		at = env.EmittedAt
+	}
+	return recordLogin(ctx, logger, nk, userID, at)
+}
+
+type getLoginCalendarRequest struct{}
+
+type calendarDay struct {
+	Day     int              `json:"day"`
+	Rewards map[string]int64 `json:"rewards"`
+	Claimed bool             `json:"claimed"`
+	Today   bool             `json:"today"`
+}
+
+type loginCalendarResponse struct {
+	Days   []calendarDay `json:"days"`
+	Streak int           `json:"streak"`
+	Best   int           `json:"best_streak"`
+	// Today is the calendar day of today's login, ClaimedToday tells if it
+	// was counted yet
+	Today        int  `json:"today"`
+	ClaimedToday bool `json:"claimed_today"`
+	// StreakBroken is set when the next login restarts the calendar
+	StreakBroken bool   `json:"streak_broken"`
+	Freezes      int    `json:"freezes"`
+	MaxFreezes   int    `json:"max_freezes"`
+	Timezone     string `json:"timezone"`
+	NextDayAt    int64  `json:"next_day_at"`
+}
+
+// GetLoginCalendarHandler returns the caller's calendar. When today's login
+// isn't counted yet, the calendar shows what it will be once it is.
+func GetLoginCalendarHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *getLoginCalendarRequest) (*loginCalendarResponse, error) {
+	userID := utils.UserID(ctx)
+	calendar := currentConfig()
+	loc, err := userLocation(ctx, nk, logger, userID)
+	if err != nil {
+		return nil, err
+	}
+	s, _, err := readStreak(ctx, nk, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().In(loc)
+	today := localDay(now, loc)
+	resp := &loginCalendarResponse{
+		Streak:       s.Streak,
+		Best:         s.Best,
+		Today:        s.CalendarDay,
+		ClaimedToday: s.LastLoginDay == today.Format(time.DateOnly),
+		Freezes:      s.Freezes,
+		MaxFreezes:   calendar.Freezes.Max,
+		Timezone:     loc.String(),
+		NextDayAt:    time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc).Unix(),
+	}
+	if !resp.ClaimedToday {
+		preview := *s
+		if r := calendar.applyLogin(&preview, today); r.counted {
+			resp.Today = preview.CalendarDay
+			resp.StreakBroken = r.reset
+		}
+	}
+
+	for _, d := range calendar.Days {
+		resp.Days = append(resp.Days, calendarDay{
+			Day:     d.Day,
+			Rewards: d.Rewards,
+			Claimed: d.Day < resp.Today || (d.Day == resp.Today && resp.ClaimedToday),
+			Today:   d.Day == resp.Today,
+		})
+	}
+	return resp, nil
+}
+
+type grantStreakFreezesRequest struct {
+	UserID string `json:"user_id" validate:"required"`
+	Count  int    `json:"count" validate:"min=1,max=100"`
+}
+
+type grantStreakFreezesResponse struct {
+	Freezes int `json:"freezes"`
+}
+
+// GrantStreakFreezesHandler adds freezes to a player's streak, e.g. after a
+// purchase
+func GrantStreakFreezesHandler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *grantStreakFreezesRequest) (*grantStreakFreezesResponse, error) {
+	s, err := grantFreezes(ctx, logger, nk, req.UserID, req.Count)
+	if err != nil {
+		return nil, err
+	}
+	return &grantStreakFreezesResponse{Freezes: s.Freezes}, nil
+}
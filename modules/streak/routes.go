@@ -0,0 +1,42 @@
+package streak
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/config"
+	eventProcessor "github.com/titan/titan-runtime/modules/common/eventProcessor"
+	"github.com/titan/titan-runtime/modules/common/notifier"
+	"github.com/titan/titan-runtime/modules/common/rpc"
+)
+
+func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	logger.Info("Initializing Streak domain...")
+	calendar, err := loadConfig(config.Env(ctx, configPathEnv, defaultConfigPath))
+	if err != nil {
+		return err
+	}
+	setConfig(calendar)
+
+	for code, t := range notificationTemplates {
+		if err := notifier.Register(code, t); err != nil {
+			return err
+		}
+	}
+
+	router := rpc.NewRouter(initializer)
+	if err := rpc.Register(router, "get_login_calendar", GetLoginCalendarHandler, rpc.RequireAuth, rpc.Timeout(rpcTimeout)); err != nil {
+		return err
+	}
+	if err := rpc.Register(router, "grant_streak_freezes", GrantStreakFreezesHandler, rpc.ServerOnly, rpc.Timeout(rpcTimeout)); err != nil {
+		return err
+	}
+
+	if err := eventProcessor.Subscribe("account_logged_in", "streak", HandleLoginEvent); err != nil {
+		return err
+	}
+
+	logger.Info("Streak domain initialized with a %d day calendar", len(calendar.Days))
+	return nil
+}
@@ -0,0 +1,163 @@
+package streak
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+	"github.com/titan/titan-runtime/modules/common/models"
+	"github.com/titan/titan-runtime/modules/common/notifier"
+	"github.com/titan/titan-runtime/modules/common/services"
+)
+
+func readStreak(ctx context.Context, nk runtime.NakamaModule, userID string) (*models.LoginStreak, string, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: streakCollection,
+		Key:        streakKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read login streak of %s: %w", userID, err)
+	}
+	if len(objects) == 0 {
+		return &models.LoginStreak{}, "", nil
+	}
+	var s models.LoginStreak
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), &s); err != nil {
+		return nil, "", fmt.Errorf("invalid login streak of %s: %w", userID, err)
+	}
+	return &s, objects[0].GetVersion(), nil
+}
+
+// streakWrite is the conditional write of s at version, players can read
+// but never write their streak
+func streakWrite(userID string, s *models.LoginStreak, version string) (*runtime.StorageWrite, error) {
+	value, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	if version == "" {
+		version = "*"
+	}
+	return &runtime.StorageWrite{
+		Collection:      streakCollection,
+		Key:             streakKey,
+		UserID:          userID,
+		Value:           string(value),
+		Version:         version,
+		PermissionRead:  runtime.STORAGE_PERMISSION_OWNER_READ,
+		PermissionWrite: runtime.STORAGE_PERMISSION_NO_WRITE,
+	}, nil
+}
+
+// userLocation is the timezone of the account, UTC when it's unset or
+// unknown
+func userLocation(ctx context.Context, nk runtime.NakamaModule, logger runtime.Logger, userID string) (*time.Location, error) {
+	account, err := services.GetAccountId(ctx, nk, logger, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account %s: %w", userID, err)
+	}
+	if account.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(account.Timezone)
+	if err != nil {
+		logger.Warn("account %s has unknown timezone %q, using UTC", userID, account.Timezone)
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
+// localDay is the date of t in loc, as midnight UTC so days can be
+// subtracted
+func localDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// recordLogin counts a login at the given time. The streak and the day's
+// reward are written in one transaction, conditional on the version read,
+// so a retried or concurrent login can't pay a day twice.
+func recordLogin(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, at time.Time) error {
+	calendar := currentConfig()
+	loc, err := userLocation(ctx, nk, logger, userID)
+	if err != nil {
+		return err
+	}
+	s, version, err := readStreak(ctx, nk, userID)
+	if err != nil {
+		return err
+	}
+
+	r := calendar.applyLogin(s, localDay(at, loc))
+	if !r.counted {
+		return nil
+	}
+	s.Timezone = loc.String()
+	s.UpdatedAt = time.Now().Unix()
+
+	record, err := streakWrite(userID, s, version)
+	if err != nil {
+		return err
+	}
+	if len(r.reward.Rewards) > 0 {
+		metadata := map[string]interface{}{
+			"reason":       "login_streak",
+			"streak":       s.Streak,
+			"calendar_day": s.CalendarDay,
+		}
+		if _, _, err := services.WalletUpdateWithRecord(ctx, nk, logger, userID, r.reward.Rewards, metadata, record); err != nil {
+			return fmt.Errorf("failed to pay login reward to %s: %w", userID, err)
+		}
+	} else if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{record}); err != nil {
+		return fmt.Errorf("failed to write login streak of %s: %w", userID, err)
+	}
+
+	logger.Debug("%s login streak is %d (calendar day %d, %d freezes used)", userID, s.Streak, s.CalendarDay, r.frozen)
+	if r.reset {
+		if err := eventEmitter.EmitEvent(ctx, nk, "login_streak_reset", map[string]string{
+			"user_id":         userID,
+			"previous_streak": strconv.Itoa(r.previous),
+		}); err != nil {
+			logger.Error("failed to emit login_streak_reset event for %s: %v", userID, err)
+		}
+	}
+
+	vars := notifier.Vars{
+		"streak":        s.Streak,
+		"calendar_day":  s.CalendarDay,
+		"rewards":       r.reward.Rewards,
+		"freezes_used":  r.frozen,
+		"earned_freeze": r.earnedFreeze,
+		"reset":         r.reset,
+	}
+	if err := notifier.Notify(ctx, nk, logger, loginRewardNotificationCode, notifier.Recipients{Self: userID}, vars); err != nil {
+		logger.Warn("Failed to send login reward notification to %s: %v", userID, err)
+	}
+	return nil
+}
+
+// grantFreezes adds count freezes to the streak of userID, up to the
+// configured maximum
+func grantFreezes(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, count int) (*models.LoginStreak, error) {
+	s, version, err := readStreak(ctx, nk, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.Freezes = min(s.Freezes+count, currentConfig().Freezes.Max)
+	s.UpdatedAt = time.Now().Unix()
+
+	record, err := streakWrite(userID, s, version)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{record}); err != nil {
+		return nil, fmt.Errorf("failed to write login streak of %s: %w", userID, err)
+	}
+	logger.Info("granted %d streak freezes to %s, %d available", count, userID, s.Freezes)
+	return s, nil
+}
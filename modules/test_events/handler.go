@@ -3,33 +3,40 @@ package test_events
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
-	"fmt"
-	"time"
 
-	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
 	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+	"github.com/titan/titan-runtime/modules/utils"
+	shared "github.com/titan/titan-runtime/shared"
 )
 
-func handleEmitEvent(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
-	// Unmarshal payload into an api.Event struct
-	evt := &api.Event{}
-	if err := json.Unmarshal([]byte(payload), evt); err != nil {
-		logger.Error("Failed to parse event payload: %v", err)
-		return "", runtime.NewError("invalid payload", 3)
-	}
+type emitEventRequest struct {
+	Name       string            `json:"name" validate:"required"`
+	Properties map[string]string `json:"properties"`
+	// IdempotencyKey is chosen by the client and reused when it retries the
+	// call, the event of a retry is dropped as a duplicate
+	IdempotencyKey string `json:"idempotency_key" validate:"required"`
+}
 
-	eventName := evt.Name
-	props := evt.Properties
+type emitEventResponse struct {
+	Status string `json:"status"`
+	Event  string `json:"event"`
+}
+
+func handleEmitEvent(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *emitEventRequest) (*emitEventResponse, error) {
+	props := make(map[string]string, len(req.Properties)+1)
+	for k, v := range req.Properties {
+		props[k] = v
+	}
+	// scoped by the caller, two users can't collide on a key
+	props[eventEmitter.IdempotencyKeyProp] = utils.UserID(ctx) + ":" + req.IdempotencyKey
 
 	// Call your custom emitter with the event name and properties from the payload.
-	if err := eventEmitter.EmitEvent(ctx, nk, eventName, props); err != nil {
-		logger.Error("Failed to emit %s event: %v", eventName, err)
-		return "", runtime.NewError("event emit failed", 13)
+	if err := eventEmitter.EmitEvent(ctx, nk, req.Name, props); err != nil {
+		logger.Error("Failed to emit %s event: %v", req.Name, err)
+		return nil, runtime.NewError("event emit failed", shared.INTERNAL)
 	}
-	time.Sleep(50000 * time.Millisecond)
 
-	logger.Info("Processed incoming event: %s", evt.Name)
-	return fmt.Sprintf(`{"status":"ok","event":"%s"}`, evt.Name), nil
+	logger.Info("Processed incoming event: %s", req.Name)
+	return &emitEventResponse{Status: "ok", Event: req.Name}, nil
 }
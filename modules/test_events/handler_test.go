@@ -0,0 +1,70 @@
+package test_events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	eventEmitter "github.com/titan/titan-runtime/modules/common/eventEmitter"
+)
+
+type testLogger struct{}
+
+func (testLogger) Debug(string, ...interface{})                       {}
+func (testLogger) Info(string, ...interface{})                        {}
+func (testLogger) Warn(string, ...interface{})                        {}
+func (testLogger) Error(string, ...interface{})                       {}
+func (l testLogger) WithField(string, interface{}) runtime.Logger     { return l }
+func (l testLogger) WithFields(map[string]interface{}) runtime.Logger { return l }
+func (testLogger) Fields() map[string]interface{}                     { return nil }
+
+// testNakama keeps the emitted events and drops the ones whose idempotency
+// key it has seen, like the event processor's dedup store
+type testNakama struct {
+	runtime.NakamaModule
+	claimed   map[string]bool
+	processed []*api.Event
+}
+
+func (n *testNakama) Event(_ context.Context, evt *api.Event) error {
+	key := evt.GetProperties()[eventEmitter.PropIdempotency]
+	if n.claimed[key] {
+		return nil
+	}
+	n.claimed[key] = true
+	n.processed = append(n.processed, evt)
+	return nil
+}
+
+func TestEmitEventRetry(t *testing.T) {
+	type call struct {
+		userID string
+		key    string
+	}
+	tests := []struct {
+		name  string
+		calls []call
+		want  int
+	}{
+		{name: "single emit", calls: []call{{"u1", "k1"}}, want: 1},
+		{name: "retried emit is dropped", calls: []call{{"u1", "k1"}, {"u1", "k1"}}, want: 1},
+		{name: "new key", calls: []call{{"u1", "k1"}, {"u1", "k2"}}, want: 2},
+		{name: "same key of another user", calls: []call{{"u1", "k1"}, {"u2", "k1"}}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nk := &testNakama{claimed: make(map[string]bool)}
+			for _, c := range tt.calls {
+				ctx := context.WithValue(context.Background(), runtime.RUNTIME_CTX_USER_ID, c.userID)
+				req := &emitEventRequest{Name: "test_event", Properties: map[string]string{"score": "10"}, IdempotencyKey: c.key}
+				if _, err := handleEmitEvent(ctx, testLogger{}, nil, nk, req); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(nk.processed) != tt.want {
+				t.Fatalf("processed %d events, want %d", len(nk.processed), tt.want)
+			}
+		})
+	}
+}
@@ -3,14 +3,26 @@ package test_events
 import (
 	"context"
 	"database/sql"
+	"strconv"
 
 	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/titan/titan-runtime/config"
+	"github.com/titan/titan-runtime/modules/common/rpc"
 )
 
+// test_emit_event lets any caller emit any event, it's only registered
+// where TEST_EVENTS_ENABLED is set, e.g. local.yml
+const enabledEnv = "TEST_EVENTS_ENABLED"
+
 // ONE InitModule per domain - handles ALL user stuff
 func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
+	if enabled, _ := strconv.ParseBool(config.Env(ctx, enabledEnv, "false")); !enabled {
+		logger.Info("Emit event domain disabled, set %s to enable it", enabledEnv)
+		return nil
+	}
+
 	logger.Info("Initializing emit event domain...")
-	if err := initializer.RegisterRpc("test_emit_event", handleEmitEvent); err != nil {
+	if err := rpc.Register(rpc.NewRouter(initializer), "test_emit_event", handleEmitEvent); err != nil {
 		return err
 	}
 
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
+
+// IsServerToServer reports whether the rpc was called with the http_key,
+// such calls carry no user id in the context
+func IsServerToServer(ctx context.Context) bool {
+	return UserID(ctx) == ""
+}
+
+// UserID returns the id of the calling user, empty for server to server
+// calls
+func UserID(ctx context.Context) string {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	return userID
+}
@@ -1,6 +1,10 @@
 package common
 
-import "github.com/heroiclabs/nakama-common/runtime"
+import (
+	"encoding/json"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+)
 
 const (
 	OK                  = 0
@@ -30,3 +34,27 @@ var (
 	ErrNotAllowed         = runtime.NewError("operation not allowed", PERMISSION_DENIED)
 	ErrNoGuildFound       = runtime.NewError("guild not found", NOT_FOUND)
 )
+
+// FieldError describes one invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ErrorBody is the message of structured errors, clients parse it from the
+// error message of the rpc response
+type ErrorBody struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// NewStructuredError returns a runtime error with an ErrorBody as message
+func NewStructuredError(message string, code int, fields []FieldError) *runtime.Error {
+	body, err := json.Marshal(ErrorBody{Code: code, Message: message, Fields: fields})
+	if err != nil {
+		return runtime.NewError(message, code)
+	}
+	return runtime.NewError(string(body), code)
+}